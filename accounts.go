@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sessionCookie names the cookie holding a session token
+	sessionCookie = "session"
+	// sessionTTL is how long a sign-in lasts
+	sessionTTL = 30 * 24 * time.Hour
+
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-SHA256
+	pbkdf2Iterations = 600_000
+)
+
+var (
+	errAccountExists   = errors.New("account already exists")
+	errAccountNotFound = errors.New("account not found")
+)
+
+// Account is a registered player
+type Account struct {
+	ID           string    `json:"id"`
+	PlayerName   string    `json:"playerName"`
+	PasswordHash string    `json:"passwordHash"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// accountKey folds a player name for case-insensitive lookups
+func accountKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// hashPassword derives a salted PBKDF2-SHA256 hash in the form
+// pbkdf2-sha256$iterations$salt$hash
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", pbkdf2Iterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// Session is the signed content of a session token
+type Session struct {
+	AccountID  string `json:"id"`
+	PlayerName string `json:"playerName"`
+	Expires    int64  `json:"exp"`
+}
+
+// sessionKey signs session tokens
+var sessionKey []byte
+
+// setupSessions sets the token signing key, making a random one when no
+// secret is configured
+func setupSessions(secret string) {
+	if secret != "" {
+		sessionKey = []byte(secret)
+		return
+	}
+	sessionKey = make([]byte, 32)
+	rand.Read(sessionKey)
+	slog.Warn("No -session-secret set; players will be signed out when the server restarts")
+}
+
+// signSession encodes a session as payload.signature, both base64url
+func signSession(s Session) string {
+	payload, _ := json.Marshal(s)
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(payload)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession checks a token's signature and expiry
+func verifySession(token string) (Session, bool) {
+	enc := base64.RawURLEncoding
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Session{}, false
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return Session{}, false
+	}
+	got, err := enc.DecodeString(sig)
+	if err != nil {
+		return Session{}, false
+	}
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return Session{}, false
+	}
+
+	var s Session
+	if json.Unmarshal(payload, &s) != nil || time.Now().Unix() >= s.Expires {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// sessionFrom returns the session of a request's bearer token or cookie
+func sessionFrom(r *http.Request) (Session, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return verifySession(strings.TrimSpace(token))
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return verifySession(c.Value)
+	}
+	return Session{}, false
+}
+
+// playerFor works out who a request plays as: the signed-in account, or
+// a guest under the given name provided no account has registered it
+func playerFor(r *http.Request, name string, verr *ValidationError) (playerName, playerID string) {
+	if s, ok := sessionFrom(r); ok {
+		return s.PlayerName, s.AccountID
+	}
+	name = normalizePlayerName(name, verr)
+	if _, err := store.Account(name); err == nil {
+		verr.add("playerName", "is registered; log in to play as %s", name)
+	}
+	return name, ""
+}
+
+// startSession signs in an account, setting the cookie and returning the
+// token for clients that prefer a bearer header
+func startSession(w http.ResponseWriter, r *http.Request, status int, a Account) {
+	expires := time.Now().Add(sessionTTL)
+	token := signSession(Session{AccountID: a.ID, PlayerName: a.PlayerName, Expires: expires.Unix()})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":         a.ID,
+		"playerName": a.PlayerName,
+		"token":      token,
+		"expires":    expires,
+	})
+}
+
+// credentials is the body of registration and sign-in requests
+type credentials struct {
+	PlayerName string `json:"playerName"`
+	Password   string `json:"password"`
+}
+
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req credentials
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	verr := &ValidationError{}
+	name := normalizePlayerName(req.PlayerName, verr)
+	switch {
+	case strings.TrimSpace(req.PlayerName) == "":
+		verr.add("playerName", "is required")
+	case strings.EqualFold(name, "Player"):
+		verr.add("playerName", "is reserved for guests")
+	}
+	if n := len(req.Password); n < minPasswordLength || n > maxPasswordLength {
+		verr.add("password", "must be %d to %d characters", minPasswordLength, maxPasswordLength)
+	}
+	if err := verr.err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		serverError(w, r, "Failed to create account", err)
+		return
+	}
+	a := Account{ID: newID(), PlayerName: name, PasswordHash: hash, CreatedAt: time.Now()}
+	err = store.AddAccount(a)
+	if errors.Is(err, errAccountExists) {
+		http.Error(w, "Player name already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to create account", err)
+		return
+	}
+	startSession(w, r, http.StatusCreated, a)
+}
+
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s, ok := sessionFrom(r)
+		if !ok {
+			http.Error(w, "Not signed in", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":         s.AccountID,
+			"playerName": s.PlayerName,
+			"expires":    time.Unix(s.Expires, 0),
+		})
+
+	case http.MethodPost:
+		var req credentials
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		a, err := store.Account(strings.Join(strings.Fields(req.PlayerName), " "))
+		if err != nil && !errors.Is(err, errAccountNotFound) {
+			serverError(w, r, "Failed to load account", err)
+			return
+		}
+		if err != nil || !checkPassword(a.PasswordHash, req.Password) {
+			http.Error(w, "Invalid name or password", http.StatusUnauthorized)
+			return
+		}
+		startSession(w, r, http.StatusOK, a)
+
+	case http.MethodDelete:
+		// Tokens are stateless, so signing out only drops the cookie; a
+		// bearer token stays valid until it expires
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
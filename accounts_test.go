@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySession(t *testing.T) {
+	setupSessions("test-secret")
+	valid := Session{AccountID: "acc1", PlayerName: "ana", Expires: time.Now().Add(time.Hour).Unix()}
+	token := signSession(valid)
+	if got, ok := verifySession(token); !ok || got != valid {
+		t.Fatalf("verifySession() = %+v, %v; want %+v", got, ok, valid)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	forged := signSession(Session{AccountID: "acc2", PlayerName: "ana", Expires: valid.Expires})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"bad signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("nope"))},
+		{"signature not base64", payload + ".!!!"},
+		{"payload not base64", "!!!." + sig},
+		{"payload swapped", forgedPayload + "." + sig},
+		{"expired", signSession(Session{AccountID: "acc1", PlayerName: "ana", Expires: time.Now().Add(-time.Second).Unix()})},
+		{"signed with another key", func() string {
+			setupSessions("other-secret")
+			defer setupSessions("test-secret")
+			return signSession(valid)
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s, ok := verifySession(tt.token); ok {
+				t.Errorf("verifySession() accepted %+v", s)
+			}
+		})
+	}
+}
+
+func TestSessionFrom(t *testing.T) {
+	setupSessions("test-secret")
+	token := signSession(Session{AccountID: "acc1", PlayerName: "ana", Expires: time.Now().Add(time.Hour).Unix()})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if s, ok := sessionFrom(r); !ok || s.AccountID != "acc1" {
+		t.Errorf("bearer token: %+v, %v", s, ok)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	if s, ok := sessionFrom(r); !ok || s.AccountID != "acc1" {
+		t.Errorf("cookie: %+v, %v", s, ok)
+	}
+
+	// A bad bearer token isn't rescued by a good cookie
+	r.Header.Set("Authorization", "Bearer junk")
+	if _, ok := sessionFrom(r); ok {
+		t.Error("bad bearer token accepted")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("right password refused")
+	}
+	if checkPassword(hash, "correct horsE") {
+		t.Error("wrong password accepted")
+	}
+	if other, _ := hashPassword("correct horse"); other == hash {
+		t.Error("two hashes of one password share a salt")
+	}
+
+	parts := strings.Split(hash, "$")
+	for name, bad := range map[string]string{
+		"empty":             "",
+		"plain text":        "correct horse",
+		"other algorithm":   strings.Join(append([]string{"bcrypt"}, parts[1:]...), "$"),
+		"missing part":      strings.Join(parts[:3], "$"),
+		"bad iterations":    strings.Join([]string{parts[0], "many", parts[2], parts[3]}, "$"),
+		"zero iterations":   strings.Join([]string{parts[0], "0", parts[2], parts[3]}, "$"),
+		"salt not base64":   strings.Join([]string{parts[0], parts[1], "!!", parts[3]}, "$"),
+		"hash not base64":   strings.Join([]string{parts[0], parts[1], parts[2], "!!"}, "$"),
+		"extra part":        hash + "$x",
+		"empty stored hash": strings.Join([]string{parts[0], parts[1], parts[2], ""}, "$"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if checkPassword(bad, "correct horse") {
+				t.Errorf("checkPassword(%q) accepted the password", bad)
+			}
+		})
+	}
+}
+
+func TestSignInIgnoresNameCase(t *testing.T) {
+	useStore(t, newMemoryStore(0))
+	setupSessions("test-secret")
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddAccount(Account{ID: "acc1", PlayerName: "Ana Lee", PasswordHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddAccount(Account{ID: "acc2", PlayerName: "ANA LEE"}); !errors.Is(err, errAccountExists) {
+		t.Errorf("registering the name in another case: %v, want %v", err, errAccountExists)
+	}
+
+	signIn := func(name, password string) int {
+		body := `{"playerName":"` + name + `","password":"` + password + `"}`
+		w := httptest.NewRecorder()
+		handleSession(w, httptest.NewRequest(http.MethodPost, "/api/session", strings.NewReader(body)))
+		return w.Code
+	}
+	tests := []struct {
+		name, playerName, password string
+		want                       int
+	}{
+		{"exact name", "Ana Lee", "correct horse", http.StatusOK},
+		{"other case", "ana lee", "correct horse", http.StatusOK},
+		{"extra spaces", "  ana   lee ", "correct horse", http.StatusOK},
+		{"wrong password", "ana lee", "wrong horse", http.StatusUnauthorized},
+		{"unknown name", "bo", "correct horse", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signIn(tt.playerName, tt.password); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Achievement is a badge players unlock by meeting a rule in a game
+type Achievement struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+
+	// unlocks reports whether a game earns the badge, given every game the
+	// player has submitted, newest first and including this one
+	unlocks func(score GameScore, history []GameScore) bool
+}
+
+// Unlock records when a player earned an achievement, and with which game
+type Unlock struct {
+	PlayerName    string    `json:"playerName"`
+	PlayerID      string    `json:"playerId,omitempty"`
+	AchievementID string    `json:"achievement"`
+	ScoreID       string    `json:"scoreId"`
+	UnlockedAt    time.Time `json:"unlockedAt"`
+}
+
+// achievements are checked, in order, after every accepted score
+var achievements = []Achievement{
+	{ID: "first-game", Name: "First Flip", Description: "Finish your first game", Icon: "🎉",
+		unlocks: func(s GameScore, history []GameScore) bool { return true }},
+	{ID: "perfect", Name: "Perfect Memory", Description: "Clear a board without a single miss", Icon: "🧠",
+		unlocks: func(s GameScore, history []GameScore) bool { return s.Moves == s.Pairs }},
+	{ID: "on-fire", Name: "On Fire", Description: "Match 5 pairs in a row", Icon: "🔥",
+		unlocks: func(s GameScore, history []GameScore) bool { return s.Combo >= 5 }},
+	{ID: "speed-demon", Name: "Speed Demon", Description: "Clear HARD in under 30 seconds", Icon: "⚡",
+		unlocks: func(s GameScore, history []GameScore) bool { return s.Difficulty == "hard" && s.TimeTaken < 30 }},
+	{ID: "daily-player", Name: "Daily Player", Description: "Finish a daily challenge", Icon: "📅",
+		unlocks: func(s GameScore, history []GameScore) bool { return s.Daily != "" }},
+	{ID: "marathon", Name: "Marathon", Description: "Play 10 games in one day", Icon: "🏃",
+		unlocks: func(s GameScore, history []GameScore) bool { return gamesOnDay(history, s.Timestamp) >= 10 }},
+	{ID: "all-rounder", Name: "All-Rounder", Description: "Finish a game on every difficulty", Icon: "🎲",
+		unlocks: func(s GameScore, history []GameScore) bool {
+			return !slices.ContainsFunc(difficulties, func(d Difficulty) bool {
+				return !slices.ContainsFunc(history, func(h GameScore) bool { return h.Difficulty == d.Name })
+			})
+		}},
+	{ID: "veteran", Name: "Veteran", Description: "Play 100 games", Icon: "🎖️",
+		unlocks: func(s GameScore, history []GameScore) bool { return len(history) >= 100 }},
+}
+
+// gamesOnDay counts the games in history played on t's UTC day
+func gamesOnDay(history []GameScore, t time.Time) int {
+	day := dailyDate(t)
+	n := 0
+	for _, h := range history {
+		if dailyDate(h.Timestamp) == day {
+			n++
+		}
+	}
+	return n
+}
+
+// unlockAchievements checks a newly stored score against every rule the
+// player hasn't met yet, records those it meets and returns them
+func unlockAchievements(score GameScore) ([]Achievement, error) {
+	history, err := store.PlayerScores(score.PlayerName, score.PlayerID)
+	if err != nil {
+		return nil, err
+	}
+	earned, err := store.Unlocks(score.PlayerName, score.PlayerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Unlock
+	for _, a := range achievements {
+		if slices.ContainsFunc(earned, func(u Unlock) bool { return u.AchievementID == a.ID }) {
+			continue
+		}
+		if a.unlocks(score, history) {
+			candidates = append(candidates, Unlock{
+				PlayerName:    score.PlayerName,
+				PlayerID:      score.PlayerID,
+				AchievementID: a.ID,
+				ScoreID:       score.ID,
+				UnlockedAt:    score.Timestamp,
+			})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	// A concurrent game may have unlocked the same badge since earned was
+	// read, so only report what the store actually added
+	added, err := store.AddUnlocks(candidates)
+	if err != nil {
+		return nil, err
+	}
+	var unlocked []Achievement
+	for _, a := range achievements {
+		if slices.ContainsFunc(added, func(u Unlock) bool { return u.AchievementID == a.ID }) {
+			unlocked = append(unlocked, a)
+		}
+	}
+	return unlocked, nil
+}
+
+// PlayerAchievement is an achievement with when the player unlocked it,
+// if they have
+type PlayerAchievement struct {
+	Achievement
+	UnlockedAt *time.Time `json:"unlockedAt,omitempty"`
+	ScoreID    string     `json:"scoreId,omitempty"`
+}
+
+// handleAchievements lists every achievement that can be unlocked
+func handleAchievements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(achievements)
+}
+
+// handlePlayerAchievements lists every achievement with the player's
+// unlocks filled in
+func handlePlayerAchievements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, id, err := lookupPlayer(r.PathValue("name"))
+	if err != nil {
+		serverError(w, r, "Failed to load achievements", err)
+		return
+	}
+	earned, err := store.Unlocks(name, id)
+	if err != nil {
+		serverError(w, r, "Failed to load achievements", err)
+		return
+	}
+
+	result := make([]PlayerAchievement, len(achievements))
+	for i, a := range achievements {
+		result[i].Achievement = a
+		for _, u := range earned {
+			if u.AchievementID == a.ID {
+				result[i].UnlockedAt = &u.UnlockedAt
+				result[i].ScoreID = u.ScoreID
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		PlayerName   string              `json:"playerName"`
+		Achievements []PlayerAchievement `json:"achievements"`
+	}{name, result})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to a flag's upper-cased name to form its
+// environment variable, e.g. -read-timeout is MEMORY_MATCH_READ_TIMEOUT
+const envPrefix = "MEMORY_MATCH_"
+
+// Config holds the server settings
+type Config struct {
+	ConfigFile       string
+	Addr             string
+	TLSCert          string
+	TLSKey           string
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	IdleTimeout      time.Duration
+	ShutdownTimeout  time.Duration
+	DrainDelay       time.Duration
+	MaxHeaderBytes   int
+	LeaderboardSize  int
+	Store            string
+	StorePath        string
+	History          time.Duration
+	Scoring          string
+	SessionSecret    string
+	DailySecret      string
+	Decks            string
+	DeckUploads      bool
+	LogLevel         slog.Level
+	LogFormat        string
+	ScoreIPRate      float64
+	ScoreIPBurst     int
+	ScorePlayerRate  float64
+	ScorePlayerBurst int
+	ScoreConcurrency int
+	AuthIPRate       float64
+	AuthIPBurst      int
+	AuthConcurrency  int
+	GameIPRate       float64
+	GameIPBurst      int
+	ClientIPHeader   string
+	TrustedProxies   string
+	Dev              bool
+}
+
+// TLS reports whether the server should listen with HTTPS
+func (c *Config) TLS() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// loadConfig builds the configuration from defaults, an optional JSON
+// config file, MEMORY_MATCH_* environment variables and command-line flags,
+// each overriding the one before
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet("memory-match", flag.ContinueOnError)
+	fs.StringVar(&cfg.ConfigFile, "config", "", "JSON file of flag names to values")
+	fs.StringVar(&cfg.Addr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file; enables HTTPS with -tls-key")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 10*time.Second, "maximum duration for reading a request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 15*time.Second, "maximum duration for writing a response")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "how long keep-alive connections stay open")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "how long to wait for requests to finish on shutdown")
+	fs.DurationVar(&cfg.DrainDelay, "drain-delay", 0, "how long /readyz reports unavailable before shutdown stops accepting connections")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", 64<<10, "maximum size of request headers")
+	fs.IntVar(&cfg.LeaderboardSize, "leaderboard-size", 10, "number of scores shown on each leaderboard")
+	fs.StringVar(&cfg.Store, "store", "memory", "score store: memory, file or sqlite")
+	fs.StringVar(&cfg.StorePath, "store-path", "", "path of the file or sqlite score store (default scores.jsonl or scores.db)")
+	fs.DurationVar(&cfg.History, "history", minHistory, "how far back the memory and file stores index scores for windowed leaderboards")
+	fs.StringVar(&cfg.Scoring, "scoring", "composite", "formula awarding leaderboard points: "+scorerNames())
+	fs.StringVar(&cfg.SessionSecret, "session-secret", "", "key for signing session tokens (default random, signing everyone out on restart)")
+	fs.Float64Var(&cfg.ScoreIPRate, "score-ip-rate", 1, "score submissions per second allowed from one IP (0 disables)")
+	fs.IntVar(&cfg.ScoreIPBurst, "score-ip-burst", 10, "score submissions one IP may make in a burst")
+	fs.Float64Var(&cfg.ScorePlayerRate, "score-player-rate", 0.2, "score submissions per second allowed from one signed-in player (0 disables)")
+	fs.IntVar(&cfg.ScorePlayerBurst, "score-player-burst", 5, "score submissions one signed-in player may make in a burst")
+	fs.IntVar(&cfg.ScoreConcurrency, "score-concurrency", 32, "score submissions handled at once (0 for no limit)")
+	fs.Float64Var(&cfg.AuthIPRate, "auth-ip-rate", 0.1, "sign-ins and registrations per second allowed from one IP (0 disables)")
+	fs.IntVar(&cfg.AuthIPBurst, "auth-ip-burst", 5, "sign-ins and registrations one IP may make in a burst")
+	fs.IntVar(&cfg.AuthConcurrency, "auth-concurrency", 4, "passwords hashed at once for sign-ins and registrations (0 for no limit)")
+	fs.Float64Var(&cfg.GameIPRate, "game-ip-rate", 0.5, "games and rooms started per second allowed from one IP (0 disables)")
+	fs.IntVar(&cfg.GameIPBurst, "game-ip-burst", 20, "games and rooms one IP may start in a burst")
+	fs.StringVar(&cfg.ClientIPHeader, "client-ip-header", "", "header a trusted proxy puts the client's IP in, such as X-Forwarded-For")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", "", "comma-separated IPs and CIDR ranges of proxies allowed to set -client-ip-header")
+	fs.StringVar(&cfg.DailySecret, "daily-secret", "", "secret mixed into daily challenge decks so layouts can't be worked out in advance")
+	fs.StringVar(&cfg.Decks, "decks", "", "directory of JSON or YAML card decks to offer alongside the built-in ones")
+	fs.BoolVar(&cfg.DeckUploads, "deck-uploads", false, "let signed-in players upload decks into -decks")
+	fs.TextVar(&cfg.LogLevel, "log-level", slog.LevelInfo, "minimum level logged: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "json", "log format: json or text")
+	fs.BoolVar(&cfg.Dev, "dev", false, "serve templates and static files from ./web for live editing")
+
+	// Env and flags are applied before the file to find it, then again
+	// so they override what the file sets
+	overlay := func() error {
+		if err := applyEnv(fs); err != nil {
+			return err
+		}
+		return fs.Parse(args)
+	}
+	if err := overlay(); err != nil {
+		return nil, err
+	}
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(fs, cfg.ConfigFile); err != nil {
+			return nil, err
+		}
+		if err := overlay(); err != nil {
+			return nil, err
+		}
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	// The leaderboard's default page can't be larger than a page may be
+	if cfg.LeaderboardSize < 1 || cfg.LeaderboardSize > maxLeaderboardLimit {
+		return nil, fmt.Errorf("-leaderboard-size must be between 1 and %d", maxLeaderboardLimit)
+	}
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return nil, fmt.Errorf("unknown -log-format %q", cfg.LogFormat)
+	}
+	if _, ok := scorers[cfg.Scoring]; !ok {
+		return nil, fmt.Errorf("unknown -scoring %q; use %s", cfg.Scoring, scorerNames())
+	}
+	if cfg.History < minHistory {
+		return nil, fmt.Errorf("-history must be at least %s to cover a calendar month", minHistory)
+	}
+	if cfg.ScoreIPRate > 0 && cfg.ScoreIPBurst < 1 {
+		return nil, errors.New("-score-ip-burst must be positive")
+	}
+	if cfg.ScorePlayerRate > 0 && cfg.ScorePlayerBurst < 1 {
+		return nil, errors.New("-score-player-burst must be positive")
+	}
+	if cfg.AuthIPRate > 0 && cfg.AuthIPBurst < 1 {
+		return nil, errors.New("-auth-ip-burst must be positive")
+	}
+	if cfg.GameIPRate > 0 && cfg.GameIPBurst < 1 {
+		return nil, errors.New("-game-ip-burst must be positive")
+	}
+	if _, err := parseProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("-trusted-proxies: %w", err)
+	}
+	if cfg.DeckUploads && cfg.Decks == "" {
+		return nil, errors.New("-deck-uploads needs a -decks directory to save to")
+	}
+	if (cfg.ClientIPHeader == "") != (cfg.TrustedProxies == "") {
+		return nil, errors.New("-client-ip-header and -trusted-proxies must be set together")
+	}
+	return cfg, nil
+}
+
+// applyEnv sets each flag that has a matching environment variable
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok && err == nil {
+			if serr := fs.Set(f.Name, value); serr != nil {
+				err = fmt.Errorf("%s: %w", name, serr)
+			}
+		}
+	})
+	return err
+}
+
+// applyConfigFile sets flags from a JSON object keyed by flag name
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for name, value := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dailyDifficulty sets the board size of the daily challenge
+const dailyDifficulty = "medium"
+
+// dailyPreset returns the difficulty the daily challenge is played at
+func dailyPreset() Difficulty {
+	d, _ := difficultyByName(dailyDifficulty)
+	return d
+}
+
+// dailySecret is mixed into each day's seed so upcoming layouts can't be
+// worked out from the date alone
+var dailySecret string
+
+// setupDaily sets the secret daily layouts are seeded with. Without one
+// the layouts follow from the date and this public code, so the server
+// warns rather than inventing a secret that would change the day's layout
+// on every restart.
+func setupDaily(secret string) {
+	dailySecret = secret
+	if secret == "" {
+		slog.Warn("No -daily-secret set; anyone can work out upcoming daily challenge layouts")
+	}
+}
+
+// dailyDate names the challenge running at t. Days roll over at midnight UTC.
+func dailyDate(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// dailyFaces is how many of the default deck's faces daily layouts draw
+// from. Fixing it keeps a day's layout the same when faces are added.
+const dailyFaces = 12
+
+// dailyDeck lays out the same deck for everyone playing on date
+func dailyDeck(date string, pairs int) []string {
+	seed := sha256.Sum256([]byte(dailySecret + "\x00" + date))
+	rng := mrand.New(mrand.NewChaCha8(seed))
+	deck, _ := deckByID(defaultDeck)
+	return shuffledDeck(deck.Faces[:dailyFaces], pairs, rng.Shuffle)
+}
+
+// guestCookie tells guests' browsers apart for daily attempts
+const guestCookie = "guest"
+
+// dailyAttempts records who has started the current day's challenge:
+// accounts by ID, and guests by browser. Flipping every card reveals the
+// shared layout, so everyone gets one attempt a day. Guests aren't keyed by
+// IP, which would give a whole office behind one address a single attempt;
+// game creation is rate limited per IP instead.
+var dailyAttempts struct {
+	sync.Mutex
+	day     string
+	started map[string]bool
+}
+
+// claimDailyAttempt records an attempt at day's challenge by key,
+// reporting false if key has already made one
+func claimDailyAttempt(day, key string) bool {
+	dailyAttempts.Lock()
+	defer dailyAttempts.Unlock()
+
+	if dailyAttempts.day != day {
+		dailyAttempts.day, dailyAttempts.started = day, make(map[string]bool)
+	}
+	if dailyAttempts.started[key] {
+		return false
+	}
+	dailyAttempts.started[key] = true
+	return true
+}
+
+// dailyAttemptKey identifies who is starting a daily challenge, giving
+// guests' browsers a cookie if they have none
+func dailyAttemptKey(w http.ResponseWriter, r *http.Request, playerID string) string {
+	if playerID != "" {
+		return "account:" + playerID
+	}
+	c, err := r.Cookie(guestCookie)
+	if err != nil || c.Value == "" {
+		c = &http.Cookie{
+			Name:     guestCookie,
+			Value:    newID(),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		http.SetCookie(w, c)
+	}
+	return "guest:" + c.Value
+}
+
+func handleDaily(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	today := dailyDate(now)
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = today
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+	// Dates compare chronologically as strings
+	if date > today {
+		http.Error(w, "Challenge not available yet", http.StatusNotFound)
+		return
+	}
+
+	d := dailyPreset()
+	top, err := store.Query(ScoreQuery{Daily: date, Limit: leaderboardSize})
+	if err != nil {
+		serverError(w, r, "Failed to load leaderboard", err)
+		return
+	}
+
+	resp := struct {
+		Date       string      `json:"date"`
+		Difficulty string      `json:"difficulty"`
+		Pairs      int         `json:"pairs"`
+		ResetsAt   *time.Time  `json:"resetsAt,omitempty"`
+		Scores     []GameScore `json:"scores"`
+	}{Date: date, Difficulty: d.Name, Pairs: d.Pairs, Scores: top}
+	if date == today {
+		reset := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		resp.ResetsAt = &reset
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleDailyArchive lists the winners of past days' challenges, newest first
+func handleDailyArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 30
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// Today's challenge is still running, so fetch one extra day to drop it
+	winners, err := store.DailyWinners(limit + 1)
+	if err != nil {
+		serverError(w, r, "Failed to load winners", err)
+		return
+	}
+	today := dailyDate(time.Now())
+	if len(winners) > 0 && winners[0].Daily == today {
+		winners = winners[1:]
+	}
+	winners = winners[:min(len(winners), limit)]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(winners)
+}
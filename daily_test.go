@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestClaimDailyAttempt(t *testing.T) {
+	t.Cleanup(func() { dailyAttempts.day, dailyAttempts.started = "", nil })
+
+	if !claimDailyAttempt("2026-01-01", "guest:a") {
+		t.Fatal("first attempt refused")
+	}
+	if claimDailyAttempt("2026-01-01", "guest:a") {
+		t.Error("second attempt from the same browser allowed")
+	}
+	if !claimDailyAttempt("2026-01-01", "guest:b") {
+		t.Error("attempt from another browser refused")
+	}
+	if !claimDailyAttempt("2026-01-02", "guest:a") {
+		t.Error("attempt on the next day refused")
+	}
+}
+
+func TestDailyAttemptKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/game", nil)
+	r.RemoteAddr = "198.51.100.7:4000"
+	if got := dailyAttemptKey(httptest.NewRecorder(), r, "acc1"); got != "account:acc1" {
+		t.Errorf("account key = %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	key := dailyAttemptKey(w, r, "")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != guestCookie {
+		t.Fatalf("new guest got cookies %v", cookies)
+	}
+	if want := "guest:" + cookies[0].Value; key != want {
+		t.Errorf("guest key = %q, want %q", key, want)
+	}
+
+	// A second guest behind the same address is told apart by their cookie
+	if other := dailyAttemptKey(httptest.NewRecorder(), r, ""); other == key {
+		t.Error("two guests on one IP share a key")
+	}
+
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	if again := dailyAttemptKey(w, r, ""); again != key {
+		t.Errorf("returning guest key = %q, want %q", again, key)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("returning guest was given a new cookie")
+	}
+}
+
+func TestDailyDeckIsShared(t *testing.T) {
+	a, b := dailyDeck("2026-01-01", 8), dailyDeck("2026-01-01", 8)
+	if !slices.Equal(a, b) {
+		t.Error("same date dealt different layouts")
+	}
+	if slices.Equal(a, dailyDeck("2026-01-02", 8)) {
+		t.Error("consecutive dates dealt the same layout")
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Deck kinds, which tell the page how to draw a card's face
+const (
+	deckEmoji = "emoji"
+	deckText  = "text"
+	deckImage = "image"
+)
+
+// defaultDeck is dealt when a game doesn't name a deck, and for the daily
+// challenge
+const defaultDeck = "neon"
+
+// maxTextFaceLength caps the characters on a text card so it fits
+const maxTextFaceLength = 12
+
+// CardDeck is a set of faces cards are drawn from. Image faces are served
+// from /decks/{id}/{file}.
+type CardDeck struct {
+	ID    string   `json:"id" yaml:"id"`
+	Name  string   `json:"name" yaml:"name"`
+	Kind  string   `json:"type" yaml:"type"`
+	Faces []string `json:"faces" yaml:"faces"`
+
+	// dir holds an image deck's files
+	dir string
+}
+
+// decksMu guards decks, which uploads add to while the server runs
+var decksMu sync.RWMutex
+
+// decks lists the decks players can pick, built-in ones first
+var decks = []CardDeck{
+	{ID: defaultDeck, Name: "Neon", Kind: deckEmoji, Faces: []string{
+		"🚀", "⚡", "🔥", "💎", "🎯", "🎮", "👾", "🤖", "🛸", "🌟", "💫", "🎪",
+		"🌈", "🎸", "🎲", "🧩", "🪐", "🌙", "🔮", "🎧", "💡", "🧬", "🦾", "🎆",
+	}},
+	{ID: "animals", Name: "Animals", Kind: deckEmoji, Faces: []string{
+		"🐶", "🐱", "🐭", "🐹", "🐰", "🦊", "🐻", "🐼", "🐨", "🐯", "🦁", "🐮",
+		"🐷", "🐸", "🐵", "🐔", "🐧", "🐦", "🦆", "🦉", "🐺", "🐗", "🐴", "🦄",
+	}},
+	{ID: "letters", Name: "Letters", Kind: deckText, Faces: strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ", "")},
+}
+
+// deckByID looks up a deck players can pick
+func deckByID(id string) (CardDeck, bool) {
+	decksMu.RLock()
+	defer decksMu.RUnlock()
+	i := slices.IndexFunc(decks, func(d CardDeck) bool { return d.ID == id })
+	if i < 0 {
+		return CardDeck{}, false
+	}
+	return decks[i], true
+}
+
+var deckIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// imageExtensions are the file types an image deck may use
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg"}
+
+// deckExtensions are the file types a deck definition may use
+var deckExtensions = []string{".json", ".yaml", ".yml"}
+
+// loadDecks adds every JSON and YAML deck in dir to the built-in ones
+func loadDecks(dir string) error {
+	var paths []string
+	for _, ext := range deckExtensions {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		d, err := readDeck(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := addDeck(d); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// addDeck offers a checked deck to players
+func addDeck(d CardDeck) error {
+	decksMu.Lock()
+	defer decksMu.Unlock()
+	if slices.ContainsFunc(decks, func(other CardDeck) bool { return other.ID == d.ID }) {
+		return fmt.Errorf("deck %q already exists", d.ID)
+	}
+	decks = append(decks, d)
+	return nil
+}
+
+// parseDeck decodes a deck definition. JSON is valid YAML, so
+// one parser reads both.
+func parseDeck(b []byte) (CardDeck, error) {
+	var d CardDeck
+	if err := yaml.Unmarshal(b, &d); err != nil {
+		return CardDeck{}, err
+	}
+	return d, nil
+}
+
+// readDeck parses and checks a deck file. Image faces name files next to
+// it and are rewritten to the URLs they're served from.
+func readDeck(path string) (CardDeck, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return CardDeck{}, err
+	}
+	d, err := parseDeck(b)
+	if err != nil {
+		return CardDeck{}, err
+	}
+	d.dir = filepath.Dir(path)
+
+	if !deckIDPattern.MatchString(d.ID) {
+		return CardDeck{}, fmt.Errorf("id %q must be up to 32 lowercase letters, digits and dashes", d.ID)
+	}
+	if d.Name == "" {
+		d.Name = d.ID
+	}
+	if minFaces := difficulties[0].Pairs; len(d.Faces) < minFaces {
+		return CardDeck{}, fmt.Errorf("needs at least %d faces, has %d", minFaces, len(d.Faces))
+	}
+	seen := make(map[string]bool)
+	for i, face := range d.Faces {
+		if seen[face] {
+			return CardDeck{}, fmt.Errorf("face %q appears twice", face)
+		}
+		seen[face] = true
+
+		switch d.Kind {
+		case deckEmoji, deckText:
+			if face == "" || utf8.RuneCountInString(face) > maxTextFaceLength {
+				return CardDeck{}, fmt.Errorf("face %q must be 1 to %d characters", face, maxTextFaceLength)
+			}
+		case deckImage:
+			if !imageFileName(face) {
+				return CardDeck{}, fmt.Errorf("face %q must be an image file in the deck's directory", face)
+			}
+			if _, err := os.Stat(filepath.Join(d.dir, face)); err != nil {
+				return CardDeck{}, err
+			}
+			d.Faces[i] = "/decks/" + d.ID + "/" + face
+		default:
+			return CardDeck{}, fmt.Errorf("unknown type %q; use emoji, text or image", d.Kind)
+		}
+	}
+	return d, nil
+}
+
+// imageFileName reports whether name is an image file with no directory
+func imageFileName(name string) bool {
+	return filepath.Base(name) == name && !strings.HasPrefix(name, ".") &&
+		slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// DeckInfo describes a deck without revealing all of its faces
+type DeckInfo struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Kind    string   `json:"type"`
+	Size    int      `json:"size"`
+	Preview []string `json:"preview"`
+}
+
+// info summarises a deck for listing
+func (d CardDeck) info() DeckInfo {
+	return DeckInfo{ID: d.ID, Name: d.Name, Kind: d.Kind, Size: len(d.Faces), Preview: d.Faces[:min(4, len(d.Faces))]}
+}
+
+// handleDecks lists the decks players can pick, with how many pairs each
+// can deal, and takes uploads when they're enabled
+func handleDecks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		decksMu.RLock()
+		infos := make([]DeckInfo, len(decks))
+		for i, d := range decks {
+			infos[i] = d.info()
+		}
+		decksMu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+
+	case http.MethodPost:
+		handleUploadDeck(w, r)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+const (
+	// maxDeckUploadBytes caps a whole deck upload, images included
+	maxDeckUploadBytes = 8 << 20
+	// maxDeckImageBytes caps each image in an upload
+	maxDeckImageBytes = 512 << 10
+)
+
+// deckUploadDir is where uploaded decks are saved, or empty when uploads
+// are disabled. deckUploadMu lets one upload at a time claim an ID.
+var (
+	deckUploadDir string
+	deckUploadMu  sync.Mutex
+)
+
+// handleUploadDeck adds a deck from a multipart form: its definition, as
+// JSON or YAML, in the deck field and, for an image deck, a file in the
+// images field for each face. The deck is saved to deckUploadDir, where
+// it is loaded again on restart.
+func handleUploadDeck(w http.ResponseWriter, r *http.Request) {
+	if deckUploadDir == "" {
+		http.Error(w, "Deck uploads are disabled", http.StatusForbidden)
+		return
+	}
+	s, ok := sessionFrom(r)
+	if !ok {
+		http.Error(w, "Sign in to upload a deck", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDeckUploadBytes)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Upload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	def, err := deckDefinition(r.MultipartForm)
+	if err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	d, err := parseDeck(def)
+	if err != nil {
+		http.Error(w, "Invalid deck: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deckUploadMu.Lock()
+	defer deckUploadMu.Unlock()
+	if _, ok := deckByID(d.ID); ok {
+		http.Error(w, "Deck ID already taken", http.StatusConflict)
+		return
+	}
+	saved, err := saveDeckUpload(d, r.MultipartForm.File["images"])
+	var invalid *ValidationError
+	switch {
+	case errors.Is(err, errDeckExists):
+		http.Error(w, "Deck ID already taken", http.StatusConflict)
+		return
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+		return
+	case err != nil:
+		serverError(w, r, "Failed to save deck", err)
+		return
+	}
+	if err := addDeck(saved); err != nil {
+		serverError(w, r, "Failed to add deck", err)
+		return
+	}
+	slog.Info("Deck uploaded", "deck", saved.ID, "player", s.PlayerName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved.info())
+}
+
+// deckDefinition reads the deck field of an upload, sent either as a value
+// or as a file
+func deckDefinition(form *multipart.Form) ([]byte, error) {
+	if files := form.File["deck"]; len(files) > 0 {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	if values := form.Value["deck"]; len(values) > 0 {
+		return []byte(values[0]), nil
+	}
+	return nil, nil
+}
+
+var errDeckExists = errors.New("deck file already exists")
+
+// saveDeckUpload checks an uploaded deck in a scratch directory, then
+// moves it into deckUploadDir, the definition last so a half-saved deck is
+// never loaded. Image faces are saved as {id}-{face} so decks sharing the
+// directory can't overwrite each other's files.
+func saveDeckUpload(d CardDeck, images []*multipart.FileHeader) (CardDeck, error) {
+	verr := &ValidationError{}
+	if !deckIDPattern.MatchString(d.ID) {
+		verr.add("deck", "id must be up to 32 lowercase letters, digits and dashes")
+		return CardDeck{}, verr
+	}
+	scratch, err := os.MkdirTemp(deckUploadDir, ".upload-")
+	if err != nil {
+		return CardDeck{}, err
+	}
+	defer os.RemoveAll(scratch)
+
+	if d.Kind == deckImage {
+		for i, face := range d.Faces {
+			if !imageFileName(face) {
+				verr.add("deck", "face %q must be an image file name", face)
+				return CardDeck{}, verr
+			}
+			j := slices.IndexFunc(images, func(h *multipart.FileHeader) bool { return h.Filename == face })
+			if j < 0 {
+				verr.add("images", "missing %q", face)
+				return CardDeck{}, verr
+			}
+			if images[j].Size > maxDeckImageBytes {
+				verr.add("images", "%q is over %d KiB", face, maxDeckImageBytes>>10)
+				return CardDeck{}, verr
+			}
+			d.Faces[i] = d.ID + "-" + face
+			if err := saveDeckImage(images[j], filepath.Join(scratch, d.Faces[i])); err != nil {
+				if errors.Is(err, errNotImage) {
+					verr.add("images", "%q is not an image", face)
+					return CardDeck{}, verr
+				}
+				return CardDeck{}, err
+			}
+		}
+	}
+	def, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return CardDeck{}, err
+	}
+	name := d.ID + ".json"
+	if err := os.WriteFile(filepath.Join(scratch, name), def, 0o644); err != nil {
+		return CardDeck{}, err
+	}
+	checked, err := readDeck(filepath.Join(scratch, name))
+	if err != nil {
+		verr.add("deck", "%s", err)
+		return CardDeck{}, verr
+	}
+
+	var files []string
+	if d.Kind == deckImage {
+		files = append(files, d.Faces...)
+	}
+	files = append(files, name)
+	for _, file := range files {
+		if _, err := os.Lstat(filepath.Join(deckUploadDir, file)); err == nil {
+			return CardDeck{}, errDeckExists
+		}
+	}
+	for _, file := range files {
+		if err := os.Rename(filepath.Join(scratch, file), filepath.Join(deckUploadDir, file)); err != nil {
+			return CardDeck{}, err
+		}
+	}
+	checked.dir = deckUploadDir
+	return checked, nil
+}
+
+var errNotImage = errors.New("not an image")
+
+// saveDeckImage copies an uploaded image to path, refusing files whose
+// content isn't an image. SVG is text, so is only checked for its tag.
+func saveDeckImage(h *multipart.FileHeader, path string) error {
+	f, err := h.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		if !bytes.Contains(data, []byte("<svg")) {
+			return errNotImage
+		}
+	} else if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return errNotImage
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// handleDeckImage serves a face of an image deck
+func handleDeckImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	d, ok := deckByID(r.PathValue("id"))
+	// Only files the deck lists are served, never anything else in its directory
+	if !ok || d.Kind != deckImage || !slices.Contains(d.Faces, r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	// SVG faces may carry scripts, which must not run if opened directly
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	http.ServeFile(w, r, filepath.Join(d.dir, r.PathValue("file")))
+}
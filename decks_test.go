@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// restoreDecks puts the deck list back as it was when the test ends
+func restoreDecks(t *testing.T) {
+	t.Helper()
+	old := slices.Clone(decks)
+	t.Cleanup(func() {
+		decksMu.Lock()
+		decks = old
+		decksMu.Unlock()
+	})
+}
+
+func TestLoadDecks(t *testing.T) {
+	restoreDecks(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"fruit.yaml": "id: fruit\nname: Fruit\ntype: text\nfaces: [apple, pear, plum, fig, kiwi, lime]\n",
+		"shapes.yml": "id: shapes\ntype: emoji\nfaces:\n  - ●\n  - ■\n  - ▲\n  - ◆\n  - ★\n  - ♥\n",
+		"nums.json":  `{"id": "nums", "name": "Numbers", "type": "text", "faces": ["1", "2", "3", "4", "5", "6"]}`,
+		"notes.txt":  "not a deck",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := loadDecks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for id, size := range map[string]int{"fruit": 6, "shapes": 6, "nums": 6} {
+		d, ok := deckByID(id)
+		if !ok || len(d.Faces) != size {
+			t.Errorf("deck %q = %+v, found %v", id, d, ok)
+		}
+	}
+	if d, _ := deckByID("shapes"); d.Name != "shapes" || d.Kind != deckEmoji {
+		t.Errorf("shapes = %+v, want named by its ID", d)
+	}
+
+	// A second directory can't reuse an ID
+	other := t.TempDir()
+	os.WriteFile(filepath.Join(other, "fruit.yml"), []byte(files["fruit.yaml"]), 0o644)
+	if err := loadDecks(other); err == nil {
+		t.Error("duplicate deck loaded")
+	}
+}
+
+// pngData starts like a PNG, which is all content sniffing looks at
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// uploadDeck posts a deck definition and images as the given session token
+func uploadDeck(t *testing.T, token, def string, images map[string][]byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("deck", def)
+	for name, data := range images {
+		fw, err := mw.CreateFormFile("images", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/decks", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handleDecks(w, r)
+	return w
+}
+
+func TestHandleUploadDeck(t *testing.T) {
+	restoreDecks(t)
+	setupSessions("test-secret")
+	token := signSession(Session{AccountID: "acc1", PlayerName: "ana", Expires: time.Now().Add(time.Hour).Unix()})
+	dir := t.TempDir()
+	deckUploadDir = dir
+	t.Cleanup(func() { deckUploadDir = "" })
+
+	faces := map[string][]byte{}
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png", "e.png", "f.png"} {
+		faces[name] = pngData
+	}
+	imageDeck := `{"id": "pics", "name": "Pictures", "type": "image", "faces": ["a.png", "b.png", "c.png", "d.png", "e.png", "f.png"]}`
+
+	tests := []struct {
+		name   string
+		token  string
+		def    string
+		images map[string][]byte
+		want   int
+	}{
+		{"signed out", "", imageDeck, faces, http.StatusUnauthorized},
+		{"image deck", token, imageDeck, faces, http.StatusCreated},
+		{"taken ID", token, imageDeck, faces, http.StatusConflict},
+		{"built-in ID", token, "id: neon\ntype: text\nfaces: [a, b, c, d, e, f]", nil, http.StatusConflict},
+		{"YAML text deck", token, "id: words\ntype: text\nfaces: [sun, moon, star, sky, sea, tree]", nil, http.StatusCreated},
+		{"bad definition", token, "id: [", nil, http.StatusBadRequest},
+		{"bad ID", token, "id: Bad/ID\ntype: text\nfaces: [a, b, c, d, e, f]", nil, http.StatusUnprocessableEntity},
+		{"too few faces", token, "id: few\ntype: text\nfaces: [a, b]", nil, http.StatusUnprocessableEntity},
+		{"missing image", token, `{"id": "gaps", "type": "image", "faces": ["a.png", "b.png", "c.png", "d.png", "e.png", "g.png"]}`, faces, http.StatusUnprocessableEntity},
+		{"face outside the directory", token, `{"id": "escape", "type": "image", "faces": ["../a.png", "b.png", "c.png", "d.png", "e.png", "f.png"]}`, faces, http.StatusUnprocessableEntity},
+		{"not an image", token, `{"id": "fake", "type": "image", "faces": ["a.png", "b.png", "c.png", "d.png", "e.png", "f.png"]}`,
+			map[string][]byte{"a.png": []byte("<script>"), "b.png": pngData, "c.png": pngData, "d.png": pngData, "e.png": pngData, "f.png": pngData},
+			http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := uploadDeck(t, tt.token, tt.def, tt.images); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	t.Run("definition as a file", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("deck", "digits.yaml")
+		fw.Write([]byte("id: digits\ntype: text\nfaces: ['1', '2', '3', '4', '5', '6']\n"))
+		mw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/api/decks", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handleDecks(w, r)
+		if w.Code != http.StatusCreated {
+			t.Errorf("status = %d, want 201: %s", w.Code, w.Body)
+		}
+	})
+
+	// Only the accepted decks were saved, and the scratch directories are gone
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"digits.json", "pics-a.png", "pics-b.png", "pics-c.png", "pics-d.png", "pics-e.png", "pics-f.png", "pics.json", "words.json"}
+	if !slices.Equal(names, want) {
+		t.Errorf("saved %v, want %v", names, want)
+	}
+
+	// The uploaded images are served, and the deck loads again on restart
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/decks/pics/pics-a.png", nil)
+	r.SetPathValue("id", "pics")
+	r.SetPathValue("file", "pics-a.png")
+	handleDeckImage(w, r)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), pngData) {
+		t.Errorf("image status = %d", w.Code)
+	}
+	if d, err := readDeck(filepath.Join(dir, "pics.json")); err != nil || d.Name != "Pictures" {
+		t.Errorf("saved deck = %+v, %v", d, err)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		deckUploadDir = ""
+		if w := uploadDeck(t, token, imageDeck, faces); w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Difficulty is a supported board size, laid out as a grid of Columns by
+// Rows cards
+type Difficulty struct {
+	Name    string `json:"name"`
+	Pairs   int    `json:"pairs"`
+	Columns int    `json:"columns"`
+	Rows    int    `json:"rows"`
+}
+
+// difficulties lists the supported board sizes, easiest first
+var difficulties = []Difficulty{
+	{Name: "easy", Pairs: 6, Columns: 3, Rows: 4},
+	{Name: "medium", Pairs: 8, Columns: 4, Rows: 4},
+	{Name: "hard", Pairs: 10, Columns: 4, Rows: 5},
+	{Name: "expert", Pairs: 12, Columns: 6, Rows: 4},
+	{Name: "master", Pairs: 18, Columns: 6, Rows: 6},
+	{Name: "legend", Pairs: 24, Columns: 8, Rows: 6},
+}
+
+// difficultyByName looks up a supported difficulty
+func difficultyByName(name string) (Difficulty, bool) {
+	for _, d := range difficulties {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Difficulty{}, false
+}
+
+// handleDifficulties lists the board sizes a game can be started with
+func handleDifficulties(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(difficulties)
+}
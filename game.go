@@ -0,0 +1,308 @@
+package main
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	mrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// gameTTL is how long an unfinished or unsubmitted session is kept
+const gameTTL = time.Hour
+
+var (
+	errGameFinished = errors.New("Game already finished")
+	errInvalidFlip  = errors.New("Card cannot be flipped")
+)
+
+// Flip records a single card flip with its server timestamp
+type Flip struct {
+	Index int       `json:"index"`
+	At    time.Time `json:"at"`
+}
+
+// GameSession holds the server-side state of a single game
+type GameSession struct {
+	ID           string
+	PlayerName   string
+	PlayerID     string
+	Difficulty   string
+	Daily        string
+	DeckID       string
+	Pairs        int
+	Deck         []string
+	Flips        []Flip
+	Moves        int
+	MatchedPairs int
+	// Combo is the longest run of consecutive matches
+	Combo      int
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Submitted  bool
+
+	matched []bool
+	faceUp  []int
+	streak  int
+}
+
+var (
+	games   = make(map[string]*GameSession)
+	gamesMu sync.Mutex
+)
+
+// newID returns a random hex identifier
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newDeck draws pairs distinct faces and returns them shuffled, two of each
+func newDeck(faces []string, pairs int) []string {
+	return shuffledDeck(faces, pairs, mrand.Shuffle)
+}
+
+// shuffledDeck builds a deck from faces using the given shuffle, so a
+// seeded source always lays out the same deck
+func shuffledDeck(faces []string, pairs int, shuffle func(n int, swap func(i, j int))) []string {
+	faces = slices.Clone(faces)
+	shuffle(len(faces), func(i, j int) { faces[i], faces[j] = faces[j], faces[i] })
+
+	deck := make([]string, 0, pairs*2)
+	deck = append(deck, faces[:pairs]...)
+	deck = append(deck, faces[:pairs]...)
+	shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	return deck
+}
+
+// newGameSession creates a session with a freshly shuffled deck. An empty
+// playerID marks a guest.
+func newGameSession(playerName, playerID string, difficulty Difficulty, deck CardDeck) *GameSession {
+	g := &GameSession{
+		ID:         newID(),
+		PlayerName: playerName,
+		PlayerID:   playerID,
+		Difficulty: difficulty.Name,
+		DeckID:     deck.ID,
+		Pairs:      difficulty.Pairs,
+		Deck:       newDeck(deck.Faces, difficulty.Pairs),
+		CreatedAt:  time.Now(),
+	}
+	g.matched = make([]bool, len(g.Deck))
+	return g
+}
+
+// FlipResult is what a flip reveals to the client
+type FlipResult struct {
+	Index        int    `json:"index"`
+	Face         string `json:"face"`
+	Pair         []int  `json:"pair,omitempty"`
+	Matched      bool   `json:"matched"`
+	Moves        int    `json:"moves"`
+	MatchedPairs int    `json:"matchedPairs"`
+	Finished     bool   `json:"finished"`
+}
+
+// flip turns a card face up, counting a move on every second card.
+// Two unmatched face-up cards are turned back down on the next flip.
+// Callers must hold gamesMu.
+func (g *GameSession) flip(index int, now time.Time) (FlipResult, error) {
+	if !g.FinishedAt.IsZero() {
+		return FlipResult{}, errGameFinished
+	}
+	if index < 0 || index >= len(g.Deck) || g.matched[index] {
+		return FlipResult{}, errInvalidFlip
+	}
+	if len(g.faceUp) == 2 {
+		g.faceUp = g.faceUp[:0]
+	}
+	if len(g.faceUp) == 1 && g.faceUp[0] == index {
+		return FlipResult{}, errInvalidFlip
+	}
+
+	if g.StartedAt.IsZero() {
+		g.StartedAt = now
+	}
+	g.Flips = append(g.Flips, Flip{Index: index, At: now})
+	g.faceUp = append(g.faceUp, index)
+
+	res := FlipResult{Index: index, Face: g.Deck[index]}
+	if len(g.faceUp) == 2 {
+		g.Moves++
+		first, second := g.faceUp[0], g.faceUp[1]
+		res.Pair = []int{first, second}
+		if g.Deck[first] == g.Deck[second] {
+			g.matched[first] = true
+			g.matched[second] = true
+			g.MatchedPairs++
+			g.faceUp = g.faceUp[:0]
+			g.streak++
+			g.Combo = max(g.Combo, g.streak)
+			res.Matched = true
+		} else {
+			g.streak = 0
+		}
+	}
+	if g.MatchedPairs == g.Pairs {
+		g.FinishedAt = now
+		res.Finished = true
+	}
+	res.Moves = g.Moves
+	res.MatchedPairs = g.MatchedPairs
+	return res, nil
+}
+
+// score builds the GameScore for a finished session from server state,
+// awarding its points with the configured scorer
+func (g *GameSession) score() GameScore {
+	elapsed := g.FinishedAt.Sub(g.StartedAt).Seconds()
+	s := GameScore{
+		ID:         g.ID,
+		PlayerName: g.PlayerName,
+		PlayerID:   g.PlayerID,
+		Guest:      g.PlayerID == "",
+		Difficulty: g.Difficulty,
+		Daily:      g.Daily,
+		Deck:       g.DeckID,
+		Pairs:      g.Pairs,
+		Moves:      g.Moves,
+		Combo:      g.Combo,
+		TimeTaken:  math.Round(elapsed*10) / 10,
+	}
+	s.Score = scorer.Score(s)
+	return s
+}
+
+// reapGames drops sessions, and empty rooms, that have outlived gameTTL
+func reapGames() {
+	for range time.Tick(time.Minute) {
+		cutoff := time.Now().Add(-gameTTL)
+		reapRooms(cutoff)
+		gamesMu.Lock()
+		for id, g := range games {
+			if g.CreatedAt.Before(cutoff) {
+				delete(games, id)
+			}
+		}
+		gamesMu.Unlock()
+	}
+}
+
+func handleNewGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PlayerName string `json:"playerName"`
+		Difficulty string `json:"difficulty"`
+		Daily      bool   `json:"daily"`
+		Deck       string `json:"deck"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	verr := &ValidationError{}
+	playerName, playerID := playerFor(r, req.PlayerName, verr)
+	// The daily challenge always uses its own board size and deck
+	if req.Daily {
+		req.Difficulty = dailyDifficulty
+		req.Deck = defaultDeck
+	}
+	difficulty, ok := difficultyByName(req.Difficulty)
+	if !ok {
+		verr.add("difficulty", "unknown difficulty %q", req.Difficulty)
+	}
+	deck, found := deckByID(cmp.Or(req.Deck, defaultDeck))
+	if !found {
+		verr.add("deck", "unknown deck %q", req.Deck)
+	} else if ok && len(deck.Faces) < difficulty.Pairs {
+		verr.add("deck", "%s has %d faces; %s needs %d", deck.Name, len(deck.Faces), difficulty.Name, difficulty.Pairs)
+	}
+	if err := verr.err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	var day string
+	if req.Daily {
+		day = dailyDate(time.Now())
+		// A daily score that made it to the board survives restarts,
+		// which forget who has started a game
+		played, err := personalBest(playerName, playerID, difficulty.Name, deck.ID, day)
+		if err != nil {
+			serverError(w, r, "Failed to load scores", err)
+			return
+		}
+		if played != nil || !claimDailyAttempt(day, dailyAttemptKey(w, r, playerID)) {
+			http.Error(w, "Today's daily challenge has already been played", http.StatusConflict)
+			return
+		}
+	}
+
+	g := newGameSession(playerName, playerID, difficulty, deck)
+	if day != "" {
+		g.Daily = day
+		g.Deck = dailyDeck(day, g.Pairs)
+	}
+	gamesMu.Lock()
+	games[g.ID] = g
+	gamesMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":         g.ID,
+		"difficulty": g.Difficulty,
+		"daily":      g.Daily,
+		"deck":       deck.ID,
+		"deckType":   deck.Kind,
+		"pairs":      g.Pairs,
+		"cards":      len(g.Deck),
+	})
+}
+
+func handleFlip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Index int `json:"index"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	gamesMu.Lock()
+	g, ok := games[r.PathValue("id")]
+	if !ok {
+		gamesMu.Unlock()
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	res, err := g.flip(req.Index, time.Now())
+	gamesMu.Unlock()
+
+	if errors.Is(err, errGameFinished) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useStore swaps the global store for the length of a test
+func useStore(t *testing.T, s ScoreStore) {
+	t.Helper()
+	old := store
+	store = s
+	t.Cleanup(func() { store = old })
+}
+
+// testGame returns an easy session whose card i pairs with card i+6,
+// registered in games until the test ends
+func testGame(t *testing.T, playerID string) *GameSession {
+	t.Helper()
+	deck := CardDeck{ID: defaultDeck, Faces: []string{"a", "b", "c", "d", "e", "f"}}
+	g := newGameSession("ana", playerID, difficulties[0], deck)
+	g.Deck = []string{"a", "b", "c", "d", "e", "f", "a", "b", "c", "d", "e", "f"}
+	gamesMu.Lock()
+	games[g.ID] = g
+	gamesMu.Unlock()
+	t.Cleanup(func() {
+		gamesMu.Lock()
+		delete(games, g.ID)
+		gamesMu.Unlock()
+	})
+	return g
+}
+
+// finishGame matches every pair in order, starting at start and flipping
+// once per gap
+func finishGame(t *testing.T, g *GameSession, start time.Time, gap time.Duration) {
+	t.Helper()
+	at := start
+	for i := range g.Pairs {
+		for _, index := range []int{i, i + g.Pairs} {
+			if _, err := g.flip(index, at); err != nil {
+				t.Fatalf("flip(%d) error = %v", index, err)
+			}
+			at = at.Add(gap)
+		}
+	}
+}
+
+func TestGameSessionFlip(t *testing.T) {
+	tests := []struct {
+		name        string
+		flips       []int
+		wantErr     error
+		wantMoves   int
+		wantMatched int
+		wantCombo   int
+	}{
+		{"one card", []int{0}, nil, 0, 0, 0},
+		{"match", []int{0, 6}, nil, 1, 1, 1},
+		{"mismatch", []int{0, 1}, nil, 1, 0, 0},
+		{"mismatch hidden on next flip", []int{0, 1, 1}, nil, 1, 0, 0},
+		{"run of matches", []int{0, 6, 1, 7, 2, 3, 4, 10}, nil, 4, 3, 2},
+		{"same card twice", []int{0, 0}, errInvalidFlip, 0, 0, 0},
+		{"matched card", []int{0, 6, 6}, errInvalidFlip, 1, 1, 1},
+		{"past the end", []int{12}, errInvalidFlip, 0, 0, 0},
+		{"negative index", []int{-1}, errInvalidFlip, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGame(t, "")
+			now := time.Unix(1000, 0)
+			var err error
+			for i, index := range tt.flips {
+				if _, err = g.flip(index, now); err != nil && i < len(tt.flips)-1 {
+					t.Fatalf("flip %d error = %v", i+1, err)
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("last flip error = %v, want %v", err, tt.wantErr)
+			}
+			if g.Moves != tt.wantMoves || g.MatchedPairs != tt.wantMatched || g.Combo != tt.wantCombo {
+				t.Errorf("moves %d, matched %d, combo %d; want %d, %d, %d",
+					g.Moves, g.MatchedPairs, g.Combo, tt.wantMoves, tt.wantMatched, tt.wantCombo)
+			}
+			if tt.wantErr != nil && len(g.Flips) != len(tt.flips)-1 {
+				t.Errorf("rejected flip was recorded: %d flips", len(g.Flips))
+			}
+		})
+	}
+}
+
+func TestGameSessionFinish(t *testing.T) {
+	g := testGame(t, "")
+	// Time spent before the first flip doesn't count
+	start := g.CreatedAt.Add(time.Minute)
+	finishGame(t, g, start, 1250*time.Millisecond)
+
+	if want := start.Add(11 * 1250 * time.Millisecond); !g.FinishedAt.Equal(want) {
+		t.Errorf("FinishedAt = %v, want the last flip at %v", g.FinishedAt, want)
+	}
+	if _, err := g.flip(0, g.FinishedAt); !errors.Is(err, errGameFinished) {
+		t.Errorf("flip after finishing error = %v, want %v", err, errGameFinished)
+	}
+
+	s := g.score()
+	// 13.75 seconds rounds to a tenth
+	if s.TimeTaken != 13.8 {
+		t.Errorf("TimeTaken = %v, want 13.8", s.TimeTaken)
+	}
+	if s.Moves != 6 || s.Combo != 6 || s.Pairs != 6 || !s.Guest {
+		t.Errorf("score = %+v", s)
+	}
+	if s.Score != scorer.Score(s) {
+		t.Errorf("Score = %d, want %d from the scorer", s.Score, scorer.Score(s))
+	}
+}
+
+// failingStore is a memory store whose Add fails
+type failingStore struct {
+	*memoryStore
+}
+
+func (failingStore) Add(GameScore) (GameScore, error) {
+	return GameScore{}, errors.New("disk full")
+}
+
+// postScore submits a game as the given session token, if any
+func postScore(gameID, token string) int {
+	r := httptest.NewRequest(http.MethodPost, "/api/score", strings.NewReader(`{"gameId":"`+gameID+`"}`))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handleScore(w, r)
+	return w.Code
+}
+
+func TestHandleScore(t *testing.T) {
+	useStore(t, newMemoryStore(0))
+	setupSessions("test-secret")
+	token := func(accountID string) string {
+		return signSession(Session{AccountID: accountID, PlayerName: "ana", Expires: time.Now().Add(time.Hour).Unix()})
+	}
+	finished := func(t *testing.T, playerID string) *GameSession {
+		g := testGame(t, playerID)
+		finishGame(t, g, time.Now(), time.Second)
+		return g
+	}
+
+	tests := []struct {
+		name  string
+		game  func(t *testing.T) string
+		token string
+		want  int
+	}{
+		{"guest game", func(t *testing.T) string { return finished(t, "").ID }, "", http.StatusOK},
+		{"own game", func(t *testing.T) string { return finished(t, "acc1").ID }, token("acc1"), http.StatusOK},
+		{"unknown game", func(t *testing.T) string { return "nope" }, "", http.StatusNotFound},
+		{"account game as a guest", func(t *testing.T) string { return finished(t, "acc1").ID }, "", http.StatusForbidden},
+		{"another player's game", func(t *testing.T) string { return finished(t, "acc1").ID }, token("acc2"), http.StatusForbidden},
+		{"unfinished", func(t *testing.T) string {
+			g := testGame(t, "")
+			g.flip(0, time.Now())
+			return g.ID
+		}, "", http.StatusConflict},
+		{"already submitted", func(t *testing.T) string {
+			g := finished(t, "")
+			g.Submitted = true
+			return g.ID
+		}, "", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postScore(tt.game(t), tt.token); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("submitted twice", func(t *testing.T) {
+		g := finished(t, "")
+		if got := postScore(g.ID, ""); got != http.StatusOK {
+			t.Fatalf("first submission = %d", got)
+		}
+		if got := postScore(g.ID, ""); got != http.StatusConflict {
+			t.Errorf("second submission = %d, want 409", got)
+		}
+	})
+
+	t.Run("claim released when storing fails", func(t *testing.T) {
+		g := finished(t, "")
+		mem := store.(*memoryStore)
+		store = failingStore{mem}
+		if got := postScore(g.ID, ""); got != http.StatusInternalServerError {
+			t.Fatalf("failed store = %d, want 500", got)
+		}
+		gamesMu.Lock()
+		submitted := g.Submitted
+		gamesMu.Unlock()
+		if submitted {
+			t.Error("game still claimed after the store failed")
+		}
+		store = mem
+		if got := postScore(g.ID, ""); got != http.StatusOK {
+			t.Errorf("retry = %d, want 200", got)
+		}
+	})
+}
@@ -1,3 +1,9 @@
 module simple-golang-application
 
 go 1.24.5
+
+require (
+	github.com/andybalholm/brotli v1.2.6
+	github.com/mattn/go-sqlite3 v1.14.33
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// version is the build version, set with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// storePingTimeout bounds how long /readyz waits on the score store
+const storePingTimeout = 2 * time.Second
+
+// shuttingDown is set once graceful shutdown begins
+var shuttingDown atomic.Bool
+
+// buildVersion returns the version, falling back to the VCS revision Go
+// stamps into the binary
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	var revision, dirty string
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && len(s.Value) >= 12:
+			revision = s.Value[:12]
+		case s.Key == "vcs.modified" && s.Value == "true":
+			dirty = "-dirty"
+		}
+	}
+	if revision == "" {
+		return version
+	}
+	return version + "+" + revision + dirty
+}
+
+// HealthStatus is the body of /healthz and /readyz
+type HealthStatus struct {
+	Status       string  `json:"status"`
+	Version      string  `json:"version"`
+	Uptime       float64 `json:"uptimeSeconds"`
+	ShuttingDown bool    `json:"shuttingDown"`
+	Store        string  `json:"store,omitempty"`
+	StoreError   string  `json:"storeError,omitempty"`
+}
+
+func newHealthStatus(status string) HealthStatus {
+	return HealthStatus{
+		Status:       status,
+		Version:      buildVersion(),
+		Uptime:       time.Since(startTime).Round(time.Second).Seconds(),
+		ShuttingDown: shuttingDown.Load(),
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, h HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(h)
+}
+
+// handleHealthz reports whether the process is alive. It stays up during
+// shutdown so the orchestrator doesn't restart a draining server.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	quietLog(r)
+	writeHealth(w, http.StatusOK, newHealthStatus("ok"))
+}
+
+// handleReadyz reports whether the server should receive traffic: the
+// score store must answer and shutdown must not have begun
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	quietLog(r)
+
+	h := newHealthStatus("ready")
+	h.Store = "ok"
+	ctx, cancel := context.WithTimeout(r.Context(), storePingTimeout)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		h.Store = "unreachable"
+		h.StoreError = err.Error()
+	}
+
+	code := http.StatusOK
+	if h.ShuttingDown || h.StoreError != "" {
+		h.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, h)
+}
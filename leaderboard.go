@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLeaderboardLimit caps the page size of /api/leaderboard
+const maxLeaderboardLimit = 100
+
+// LeaderboardPage is one page of a leaderboard query. Total counts every
+// matching score; NextCursor is set when more follow.
+type LeaderboardPage struct {
+	Scores     []GameScore `json:"scores"`
+	Total      int         `json:"total"`
+	Offset     int         `json:"offset"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// pageCursor is the position of the last score on a page, in the sort
+// order it was read in
+type pageCursor struct {
+	Sort      string    `json:"s"`
+	Score     int       `json:"p"`
+	Moves     int       `json:"m"`
+	TimeTaken float64   `json:"t"`
+	Timestamp time.Time `json:"ts"`
+	ID        string    `json:"id"`
+}
+
+func encodeCursor(sort string, s GameScore) string {
+	b, _ := json.Marshal(pageCursor{sort, s.Score, s.Moves, s.TimeTaken, s.Timestamp, s.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(sort, cursor string) (*GameScore, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.Sort != sort || c.ID == "" {
+		return nil, errors.New("cursor is from another query")
+	}
+	return &GameScore{ID: c.ID, Score: c.Score, Moves: c.Moves, TimeTaken: c.TimeTaken, Timestamp: c.Timestamp}, nil
+}
+
+// parseTimeParam reads an RFC 3339 time or a date, taken as midnight in
+// loc. With endOfDay a date covers the whole day.
+func parseTimeParam(v string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, loc)
+	if err == nil && endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, err
+}
+
+// intParam reads a non-negative integer query parameter, or def if unset
+func intParam(params url.Values, name string, def int) (int, bool) {
+	v := params.Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n >= 0
+}
+
+// handleLeaderboard serves a page of a difficulty and deck's scores, optionally
+// filtered by player name prefix and time, in the requested order
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	q := ScoreQuery{
+		Difficulty:   cmp.Or(params.Get("difficulty"), difficulties[0].Name),
+		Deck:         cmp.Or(params.Get("deck"), defaultDeck),
+		PlayerPrefix: strings.TrimSpace(params.Get("player")),
+		Sort:         cmp.Or(params.Get("sort"), sortScore),
+		Flagged:      params.Get("flagged") == "true",
+	}
+	if _, ok := difficultyByName(q.Difficulty); !ok {
+		http.Error(w, "Unknown difficulty", http.StatusBadRequest)
+		return
+	}
+	if _, ok := deckByID(q.Deck); !ok {
+		http.Error(w, "Unknown deck", http.StatusBadRequest)
+		return
+	}
+	if _, ok := scoreSorts[q.Sort]; !ok {
+		http.Error(w, "Unknown sort; use score, moves or time", http.StatusBadRequest)
+		return
+	}
+
+	loc, err := time.LoadLocation(cmp.Or(params.Get("tz"), "UTC"))
+	if err != nil {
+		http.Error(w, "Unknown time zone", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	q.Since, err = windowStart(params.Get("window"), now, loc)
+	if err != nil {
+		http.Error(w, "Invalid window: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("from"); v != "" {
+		from, err := parseTimeParam(v, loc, false)
+		if err != nil {
+			http.Error(w, "Invalid from; use a date or RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		if from.After(q.Since) {
+			q.Since = from
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		q.Until, err = parseTimeParam(v, loc, true)
+		if err != nil {
+			http.Error(w, "Invalid to; use a date or RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit, ok := intParam(params, "limit", leaderboardSize)
+	if !ok || limit < 1 || limit > maxLeaderboardLimit {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	q.Offset, ok = intParam(params, "offset", 0)
+	if !ok {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("cursor"); v != "" {
+		if q.Offset > 0 {
+			http.Error(w, "Use either offset or cursor", http.StatusBadRequest)
+			return
+		}
+		if q.After, err = decodeCursor(q.Sort, v); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	total, err := store.Count(q)
+	if err != nil {
+		serverError(w, r, "Failed to load leaderboard", err)
+		return
+	}
+	// Read one extra score to learn whether another page follows
+	q.Limit = limit + 1
+	scores, err := store.Query(q)
+	if err != nil {
+		serverError(w, r, "Failed to load leaderboard", err)
+		return
+	}
+
+	page := LeaderboardPage{Scores: scores, Total: total, Offset: q.Offset, Limit: limit}
+	if len(scores) > limit {
+		page.Scores = scores[:limit]
+		page.NextCursor = encodeCursor(q.Sort, scores[limit-1])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRequestIDLength caps the length of a client-supplied X-Request-ID
+const maxRequestIDLength = 64
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	logFieldsKey
+)
+
+// setupLogging installs the default slog logger. The log package writes
+// through it too.
+func setupLogging(level slog.Level, format string) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if format == "text" {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(requestIDHandler{h}))
+}
+
+// requestIDHandler adds the request ID to records logged with a request's
+// context
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		r.AddAttrs(slog.String("requestId", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// middleware wraps a handler with cross-cutting behaviour
+type middleware func(http.Handler) http.Handler
+
+// chain applies middleware so the first listed runs first
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// validRequestID reports whether a client-supplied ID is safe to echo and log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+}
+
+// withRequestID tags each request with the caller's X-Request-ID, or a new
+// one, and echoes it in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newID()[:16]
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// logFields collects attributes handlers add to their request's log line
+type logFields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+	quiet bool
+}
+
+// addLogFields attaches attributes to the request's log line
+func addLogFields(r *http.Request, attrs ...slog.Attr) {
+	if f, ok := r.Context().Value(logFieldsKey).(*logFields); ok {
+		f.mu.Lock()
+		f.attrs = append(f.attrs, attrs...)
+		f.mu.Unlock()
+	}
+}
+
+// quietLog logs a successful request at debug level, for frequent polls
+// such as health probes
+func quietLog(r *http.Request) {
+	if f, ok := r.Context().Value(logFieldsKey).(*logFields); ok {
+		f.mu.Lock()
+		f.quiet = true
+		f.mu.Unlock()
+	}
+}
+
+// serverError logs err against the request and responds 500 with message
+func serverError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	addLogFields(r, slog.String("error", err.Error()))
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// withRequestLog writes a line per request once it completes, at warning
+// level for client errors and error level for server errors
+func withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		fields := &logFields{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), logFieldsKey, fields)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields.mu.Lock()
+		defer fields.mu.Unlock()
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case fields.quiet:
+			level = slog.LevelDebug
+		}
+		attrs := append([]slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.String("clientIp", clientIP(r)),
+		}, fields.attrs...)
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// statusRecorder remembers the status code a handler writes
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack records a WebSocket upgrade as 101 Switching Protocols
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
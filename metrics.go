@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric is a family written out in the Prometheus text exposition format
+type metric interface {
+	write(w io.Writer)
+}
+
+// metrics lists every registered family in output order
+var metrics []metric
+
+func register[M metric](m M) M {
+	metrics = append(metrics, m)
+	return m
+}
+
+var (
+	httpRequests = register(newCounterVec("memory_match_http_requests_total",
+		"HTTP requests served, by route, method and status code.", "route", "method", "code"))
+	httpDuration = register(newHistogramVec("memory_match_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route.",
+		[]float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}, "route"))
+	scoreSubmissions = register(newCounterVec("memory_match_score_submissions_total",
+		"Score submissions, by whether they were accepted or rejected.", "result"))
+	scoreRejections = register(newCounterVec("memory_match_score_rejections_total",
+		"Rejected score submissions, by reason.", "reason"))
+	scoreFlags = register(newCounterVec("memory_match_score_flags_total",
+		"Accepted scores flagged for review, by reason.", "reason"))
+	rateLimited = register(newCounterVec("memory_match_rate_limited_total",
+		"Requests turned away by rate or concurrency limits, by route and reason.", "route", "reason"))
+	gameMoves = register(newHistogramVec("memory_match_game_moves",
+		"Moves taken in accepted games, by difficulty.",
+		[]float64{6, 8, 10, 12, 15, 20, 25, 30, 40, 50, 75, 100, 150}, "difficulty"))
+	gameTime = register(newHistogramVec("memory_match_game_time_seconds",
+		"Time taken in accepted games, by difficulty.",
+		[]float64{5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 300, 600}, "difficulty"))
+	_ = register(&gaugeFunc{
+		name:   "memory_match_leaderboard_scores",
+		help:   "Scores ranked on each difficulty's leaderboard.",
+		labels: []string{"difficulty"},
+		collect: func(emit func(float64, ...string)) {
+			for _, d := range difficulties {
+				// Rank reports the board's size alongside any score's position
+				if _, total, err := store.Rank(GameScore{Difficulty: d.Name}); err == nil {
+					emit(float64(total), d.Name)
+				}
+			}
+		},
+	})
+	_ = register(&gaugeFunc{
+		name: "memory_match_games_active",
+		help: "Single-player game sessions held in memory.",
+		collect: func(emit func(float64, ...string)) {
+			gamesMu.Lock()
+			n := len(games)
+			gamesMu.Unlock()
+			emit(float64(n))
+		},
+	})
+	_ = register(&gaugeFunc{
+		name: "memory_match_rooms_open",
+		help: "Multiplayer rooms open.",
+		collect: func(emit func(float64, ...string)) {
+			roomsMu.Lock()
+			n := len(rooms)
+			roomsMu.Unlock()
+			emit(float64(n))
+		},
+	})
+)
+
+// acceptScore records an accepted submission and its game stats
+func acceptScore(score GameScore) {
+	scoreSubmissions.inc("accepted")
+	gameMoves.observe(float64(score.Moves), score.Difficulty)
+	gameTime.observe(score.TimeTaken, score.Difficulty)
+}
+
+// rejectScore records a rejected submission and why on its log line
+func rejectScore(r *http.Request, reason string) {
+	addLogFields(r, slog.String("rejected", reason))
+	scoreSubmissions.inc("rejected")
+	scoreRejections.inc(reason)
+}
+
+// flagScore records an accepted submission whose play looks automated
+func flagScore(r *http.Request, reason string) {
+	addLogFields(r, slog.String("flagged", reason))
+	scoreFlags.inc(reason)
+}
+
+// labelPairs formats label names and values as name="value",...
+func labelPairs(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs[i] = name + `="` + v + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// braced wraps label pairs in braces, or returns "" when there are none
+func braced(pairs string) string {
+	if pairs == "" {
+		return ""
+	}
+	return "{" + pairs + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// counterVec is a counter partitioned by labels
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// inc adds one to the series with the given label values
+func (c *counterVec) inc(values ...string) {
+	key := labelPairs(c.labels, values)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(c.values)) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braced(key), formatFloat(c.values[key]))
+	}
+}
+
+// histogram counts observations into buckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a histogram partitioned by labels
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// observe records v in the series with the given label values
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := labelPairs(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(h.series)) {
+		s := h.series[key]
+		prefix := key
+		if prefix != "" {
+			prefix += ","
+		}
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", h.name, prefix, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.name, prefix, s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braced(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braced(key), s.count)
+	}
+}
+
+// gaugeFunc is a gauge whose values are read at scrape time
+type gaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	g.collect(func(value float64, labelValues ...string) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, braced(labelPairs(g.labels, labelValues)), formatFloat(value))
+	})
+}
+
+// methodLabel returns a request's method, or "other" for anything outside
+// the standard set, so clients can't create series at will
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// instrument counts and times requests to a route
+func instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequests.inc(route, methodLabel(r.Method), strconv.Itoa(rec.status))
+		httpDuration.observe(time.Since(start).Seconds(), route)
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	bw.Flush()
+}
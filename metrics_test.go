@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentMethodLabel(t *testing.T) {
+	h := instrument("/test-route", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	for _, method := range []string{http.MethodGet, "FOOBAR", "get", http.MethodDelete} {
+		h(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+
+	var b strings.Builder
+	httpRequests.write(&b)
+	var series []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.Contains(line, `route="/test-route"`) {
+			series = append(series, line)
+		}
+	}
+	want := []string{
+		`memory_match_http_requests_total{route="/test-route",method="DELETE",code="418"} 1`,
+		`memory_match_http_requests_total{route="/test-route",method="GET",code="418"} 1`,
+		`memory_match_http_requests_total{route="/test-route",method="other",code="418"} 2`,
+	}
+	if strings.Join(series, "\n") != strings.Join(want, "\n") {
+		t.Errorf("series =\n%s\nwant\n%s", strings.Join(series, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// profileRecentGames is how many recent games a profile lists
+const profileRecentGames = 20
+
+// Placement describes where a score sits on its difficulty's leaderboard
+type Placement struct {
+	Rank       int     `json:"rank"`
+	Total      int     `json:"total"`
+	Percentile float64 `json:"percentile"`
+	TopN       bool    `json:"topN"`
+}
+
+// placementOf ranks a stored score against the rest of its difficulty
+func placementOf(score GameScore) (Placement, error) {
+	rank, total, err := store.Rank(score)
+	if err != nil {
+		return Placement{}, err
+	}
+	total = max(total, rank)
+	return Placement{
+		Rank:       rank,
+		Total:      total,
+		Percentile: math.Round(float64(total-rank+1)/float64(total)*1000) / 10,
+		TopN:       rank <= leaderboardSize,
+	}, nil
+}
+
+// personalBest returns a player's best score on a difficulty with a deck,
+// or on a day's challenge, if any
+func personalBest(playerName, playerID, difficulty, deck, daily string) (*GameScore, error) {
+	best, err := store.Query(ScoreQuery{
+		Difficulty: difficulty, Deck: deck, Daily: daily, PlayerName: playerName, PlayerID: playerID, Limit: 1,
+	})
+	if err != nil || len(best) == 0 {
+		return nil, err
+	}
+	return &best[0], nil
+}
+
+// lookupPlayer resolves a name from a URL to the account registered under
+// it, ignoring case, or else to the guest playing under it
+func lookupPlayer(name string) (playerName, playerID string, err error) {
+	a, err := store.Account(name)
+	if errors.Is(err, errAccountNotFound) {
+		return name, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return a.PlayerName, a.ID, nil
+}
+
+func handlePlayerRank(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	difficulty := r.URL.Query().Get("difficulty")
+	if difficulty == "" {
+		difficulty = difficulties[0].Name
+	}
+	if _, ok := difficultyByName(difficulty); !ok {
+		http.Error(w, "Unknown difficulty", http.StatusBadRequest)
+		return
+	}
+	deck := cmp.Or(r.URL.Query().Get("deck"), defaultDeck)
+	if _, ok := deckByID(deck); !ok {
+		http.Error(w, "Unknown deck", http.StatusBadRequest)
+		return
+	}
+
+	name, id, err := lookupPlayer(r.PathValue("name"))
+	if err != nil {
+		serverError(w, r, "Failed to load player", err)
+		return
+	}
+	best, err := personalBest(name, id, difficulty, deck, "")
+	if err != nil {
+		serverError(w, r, "Failed to load scores", err)
+		return
+	}
+	if best == nil {
+		http.Error(w, "No scores for player", http.StatusNotFound)
+		return
+	}
+	placement, err := placementOf(*best)
+	if err != nil {
+		serverError(w, r, "Failed to rank score", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		PlayerName string    `json:"playerName"`
+		Difficulty string    `json:"difficulty"`
+		Best       GameScore `json:"best"`
+		Placement
+	}{name, difficulty, *best, placement})
+}
+
+// DifficultyStats summarises a player's games on one difficulty
+type DifficultyStats struct {
+	Difficulty   string  `json:"difficulty"`
+	Games        int     `json:"games"`
+	BestScore    int     `json:"bestScore"`
+	BestMoves    int     `json:"bestMoves"`
+	AverageMoves float64 `json:"averageMoves"`
+	MedianMoves  float64 `json:"medianMoves"`
+	BestTime     float64 `json:"bestTime"`
+	AverageTime  float64 `json:"averageTime"`
+	MedianTime   float64 `json:"medianTime"`
+}
+
+// Streak is a player's current and longest run of something
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// PlayerProfile is the body of /api/players/{name}. DayStreak counts
+// consecutive UTC days with a game; WinStreak counts head-to-head wins.
+type PlayerProfile struct {
+	PlayerName   string            `json:"playerName"`
+	Registered   bool              `json:"registered"`
+	GamesPlayed  int               `json:"gamesPlayed"`
+	FirstPlayed  *time.Time        `json:"firstPlayed,omitempty"`
+	LastPlayed   *time.Time        `json:"lastPlayed,omitempty"`
+	Difficulties []DifficultyStats `json:"difficulties"`
+	DayStreak    Streak            `json:"dayStreak"`
+	Matches      int               `json:"matches"`
+	MatchWins    int               `json:"matchWins"`
+	WinStreak    Streak            `json:"winStreak"`
+	Recent       []GameScore       `json:"recent"`
+}
+
+// round1 rounds to one decimal place
+func round1(x float64) float64 {
+	return math.Round(x*10) / 10
+}
+
+// median returns the middle of xs, averaging the two middle values of an
+// even count
+func median(xs []float64) float64 {
+	xs = slices.Sorted(slices.Values(xs))
+	mid := len(xs) / 2
+	if len(xs)%2 == 0 {
+		return (xs[mid-1] + xs[mid]) / 2
+	}
+	return xs[mid]
+}
+
+// difficultyStats summarises scores, all from one difficulty
+func difficultyStats(difficulty string, scores []GameScore) DifficultyStats {
+	st := DifficultyStats{Difficulty: difficulty, Games: len(scores), BestMoves: math.MaxInt, BestTime: math.Inf(1)}
+	moves := make([]float64, len(scores))
+	times := make([]float64, len(scores))
+	for i, s := range scores {
+		st.BestScore = max(st.BestScore, s.Score)
+		st.BestMoves = min(st.BestMoves, s.Moves)
+		st.BestTime = min(st.BestTime, s.TimeTaken)
+		moves[i], times[i] = float64(s.Moves), s.TimeTaken
+		st.AverageMoves += moves[i]
+		st.AverageTime += times[i]
+	}
+	st.AverageMoves = round1(st.AverageMoves / float64(len(scores)))
+	st.AverageTime = round1(st.AverageTime / float64(len(scores)))
+	st.MedianMoves = round1(median(moves))
+	st.MedianTime = round1(median(times))
+	return st
+}
+
+// dayStreak counts runs of consecutive UTC days in scores, which are
+// newest first. The current run ends today or yesterday.
+func dayStreak(scores []GameScore, now time.Time) Streak {
+	var streak Streak
+	run := 0
+	var last time.Time
+	for i := len(scores) - 1; i >= 0; i-- {
+		y, m, d := scores[i].Timestamp.UTC().Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		switch {
+		case run > 0 && day.Equal(last):
+			continue
+		case run > 0 && day.Equal(last.AddDate(0, 0, 1)):
+			run++
+		default:
+			run = 1
+		}
+		last = day
+		streak.Longest = max(streak.Longest, run)
+	}
+	if run > 0 && !last.Before(now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)) {
+		streak.Current = run
+	}
+	return streak
+}
+
+// winStreak counts the matches a player played and won, and their runs of
+// wins, from matches newest first
+func winStreak(name, id string, matches []MatchResult) (played, won int, streak Streak) {
+	player := playerKey(name, id)
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		if !slices.ContainsFunc(m.Players, func(p MatchPlayer) bool { return playerKey(p.Name, p.PlayerID) == player }) {
+			continue
+		}
+		played++
+		winner := slices.ContainsFunc(m.Players, func(p MatchPlayer) bool { return p.Won && playerKey(p.Name, p.PlayerID) == player })
+		// Older matches only name their winners, so there a guest shares
+		// an account's wins
+		if !slices.ContainsFunc(m.Players, func(p MatchPlayer) bool { return p.Won }) {
+			winner = slices.Contains(m.Winners, name)
+		}
+		if winner {
+			won++
+			streak.Current++
+			streak.Longest = max(streak.Longest, streak.Current)
+		} else {
+			streak.Current = 0
+		}
+	}
+	return played, won, streak
+}
+
+func handlePlayerProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Registered names are matched regardless of case
+	name, id, err := lookupPlayer(r.PathValue("name"))
+	if err != nil {
+		serverError(w, r, "Failed to load player", err)
+		return
+	}
+	p := PlayerProfile{PlayerName: name, Registered: id != ""}
+	scores, err := store.PlayerScores(name, id)
+	if err != nil {
+		serverError(w, r, "Failed to load scores", err)
+		return
+	}
+	matches, err := store.Matches(0)
+	if err != nil {
+		serverError(w, r, "Failed to load matches", err)
+		return
+	}
+	p.Matches, p.MatchWins, p.WinStreak = winStreak(name, id, matches)
+	if len(scores) == 0 && p.Matches == 0 && !p.Registered {
+		http.Error(w, "No such player", http.StatusNotFound)
+		return
+	}
+
+	p.GamesPlayed = len(scores)
+	if len(scores) > 0 {
+		p.LastPlayed, p.FirstPlayed = &scores[0].Timestamp, &scores[len(scores)-1].Timestamp
+	}
+	p.Difficulties = []DifficultyStats{}
+	for _, d := range difficulties {
+		played := slices.DeleteFunc(slices.Clone(scores), func(s GameScore) bool { return s.Difficulty != d.Name })
+		if len(played) > 0 {
+			p.Difficulties = append(p.Difficulties, difficultyStats(d.Name, played))
+		}
+	}
+	p.DayStreak = dayStreak(scores, time.Now())
+	p.Recent = scores[:min(len(scores), profileRecentGames)]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
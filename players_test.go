@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestWinStreak(t *testing.T) {
+	guest := func(name string, won bool) MatchPlayer { return MatchPlayer{Name: name, Won: won} }
+	// Newest first: two guests called Player, and one account, take turns winning
+	matches := []MatchResult{
+		{Players: []MatchPlayer{guest("Player", true), guest("Player", false)}, Winners: []string{"Player"}},
+		{Players: []MatchPlayer{guest("Player", false), {Name: "Ana", PlayerID: "acc1", Won: true}}, Winners: []string{"Ana"}},
+		{Players: []MatchPlayer{{Name: "Ana", PlayerID: "acc1", Won: true}, guest("Ana", false)}, Winners: []string{"Ana"}},
+		{Players: []MatchPlayer{{Name: "Ana", PlayerID: "acc1", Won: true}, guest("Player", false)}, Winners: []string{"Ana"}},
+		// Recorded before winners were marked on each player
+		{Players: []MatchPlayer{guest("Player", false), guest("Bo", false)}, Winners: []string{"Bo"}},
+		{Players: []MatchPlayer{guest("Player", false), guest("Bo", false)}, Winners: []string{"Player"}},
+	}
+
+	tests := []struct {
+		name, id      string
+		played, won   int
+		current, best int
+	}{
+		{"Ana", "acc1", 3, 3, 3, 3},
+		// The guest who shares the account's name won none of its matches
+		{"Ana", "", 1, 0, 0, 0},
+		// Guests sharing a name are one player, who lost to the account
+		{"Player", "", 5, 2, 1, 1},
+		{"Bo", "", 2, 1, 1, 1},
+		{"Cy", "", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+tt.id, func(t *testing.T) {
+			played, won, streak := winStreak(tt.name, tt.id, matches)
+			if played != tt.played || won != tt.won || streak.Current != tt.current || streak.Longest != tt.best {
+				t.Errorf("played %d, won %d, streak %+v; want %d, %d, {Current:%d Longest:%d}",
+					played, won, streak, tt.played, tt.won, tt.current, tt.best)
+			}
+		})
+	}
+}
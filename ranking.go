@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	mrand "math/rand/v2"
+	"strings"
+)
+
+// compareScores orders by points, highest first, then as compareByMoves
+func compareScores(a, b GameScore) int {
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	return compareByMoves(a, b)
+}
+
+// compareByMoves orders by moves, then time, then submission time, with the
+// ID as a final tiebreak so every score has a distinct position
+func compareByMoves(a, b GameScore) int {
+	if c := cmp.Compare(a.Moves, b.Moves); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.TimeTaken, b.TimeTaken); c != 0 {
+		return c
+	}
+	if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareByTime orders fastest first, then as compareByMoves
+func compareByTime(a, b GameScore) int {
+	if c := cmp.Compare(a.TimeTaken, b.TimeTaken); c != 0 {
+		return c
+	}
+	return compareByMoves(a, b)
+}
+
+// rankNode is a treap node carrying the size of its subtree
+type rankNode struct {
+	score       GameScore
+	priority    uint64
+	size        int
+	left, right *rankNode
+}
+
+func (n *rankNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *rankNode) update() {
+	n.size = 1 + n.left.len() + n.right.len()
+}
+
+// rankedIndex is an order-statistic treap of scores, best first. Insert,
+// delete and rank lookups are O(log n).
+type rankedIndex struct {
+	root *rankNode
+}
+
+func newRankedIndex() *rankedIndex {
+	return &rankedIndex{}
+}
+
+// Len returns the number of scores in the index
+func (t *rankedIndex) Len() int {
+	return t.root.len()
+}
+
+// Insert adds a score
+func (t *rankedIndex) Insert(score GameScore) {
+	left, right := split(t.root, score)
+	node := &rankNode{score: score, priority: mrand.Uint64(), size: 1}
+	t.root = merge(merge(left, node), right)
+}
+
+// Delete removes a score, reporting whether it was present
+func (t *rankedIndex) Delete(score GameScore) bool {
+	var ok bool
+	t.root, ok = deleteNode(t.root, score)
+	return ok
+}
+
+// Rank returns the 1-based position score holds, or would hold, in the index
+func (t *rankedIndex) Rank(score GameScore) int {
+	rank := 1
+	for n := t.root; n != nil; {
+		if compareScores(score, n.score) <= 0 {
+			n = n.left
+		} else {
+			rank += n.left.len() + 1
+			n = n.right
+		}
+	}
+	return rank
+}
+
+// Ascend calls fn on each score in order starting at the given 0-based
+// position, stopping early if fn returns false
+func (t *rankedIndex) Ascend(start int, fn func(GameScore) bool) {
+	ascend(t.root, start, fn)
+}
+
+func ascend(n *rankNode, skip int, fn func(GameScore) bool) bool {
+	if n == nil {
+		return true
+	}
+	leftLen := n.left.len()
+	if skip < leftLen {
+		if !ascend(n.left, skip, fn) {
+			return false
+		}
+	}
+	if skip <= leftLen {
+		if !fn(n.score) {
+			return false
+		}
+	}
+	return ascend(n.right, max(skip-leftLen-1, 0), fn)
+}
+
+// split partitions n into scores ordered before key and the rest
+func split(n *rankNode, key GameScore) (*rankNode, *rankNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if compareScores(n.score, key) < 0 {
+		left, right := split(n.right, key)
+		n.right = left
+		n.update()
+		return n, right
+	}
+	left, right := split(n.left, key)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// merge joins two treaps where every score in a orders before those in b
+func merge(a, b *rankNode) *rankNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
+
+func deleteNode(n *rankNode, key GameScore) (*rankNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	var ok bool
+	switch c := compareScores(key, n.score); {
+	case c < 0:
+		n.left, ok = deleteNode(n.left, key)
+	case c > 0:
+		n.right, ok = deleteNode(n.right, key)
+	default:
+		return merge(n.left, n.right), true
+	}
+	if ok {
+		n.update()
+	}
+	return n, ok
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	mrand "math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testScore builds a score ranked by its points alone
+func testScore(id string, points int) GameScore {
+	return GameScore{ID: id, Difficulty: "medium", Deck: defaultDeck, Score: points, Moves: 10, TimeTaken: 30}
+}
+
+// ids lists the IDs of every score in the index, in order from start
+func ids(t *rankedIndex, start int) []string {
+	var result []string
+	t.Ascend(start, func(s GameScore) bool {
+		result = append(result, s.ID)
+		return true
+	})
+	return result
+}
+
+func TestRankedIndexInsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  []int
+		wantIDs []string
+	}{
+		{"best first", []int{100, 300, 200}, []string{"s1", "s2", "s0"}},
+		{"already ordered", []int{300, 200, 100}, []string{"s0", "s1", "s2"}},
+		// Ties are broken by ID
+		{"ties", []int{200, 200, 300}, []string{"s2", "s0", "s1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newRankedIndex()
+			for i, p := range tt.points {
+				index.Insert(testScore(fmt.Sprintf("s%d", i), p))
+			}
+			if got := ids(index, 0); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("order = %v, want %v", got, tt.wantIDs)
+			}
+			if index.Len() != len(tt.wantIDs) {
+				t.Errorf("Len() = %d, want %d", index.Len(), len(tt.wantIDs))
+			}
+		})
+	}
+}
+
+func TestRankedIndexRank(t *testing.T) {
+	index := newRankedIndex()
+	for i, p := range []int{500, 400, 300, 200, 100} {
+		index.Insert(testScore(fmt.Sprintf("s%d", i), p))
+	}
+	tests := []struct {
+		name  string
+		score GameScore
+		want  int
+	}{
+		{"best", testScore("s0", 500), 1},
+		{"middle", testScore("s2", 300), 3},
+		{"worst", testScore("s4", 100), 5},
+		{"new best", testScore("x", 600), 1},
+		{"between", testScore("x", 250), 4},
+		{"new worst", testScore("x", 50), 6},
+		// Ties are broken by ID, as the board would order them
+		{"tie before", testScore("a", 300), 3},
+		{"tie after", testScore("z", 300), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := index.Rank(tt.score); got != tt.want {
+				t.Errorf("Rank() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankedIndexAscendSkip(t *testing.T) {
+	index := newRankedIndex()
+	var all []string
+	for i := range 50 {
+		id := fmt.Sprintf("s%02d", i)
+		index.Insert(testScore(id, 1000-i))
+		all = append(all, id)
+	}
+	for _, skip := range []int{0, 1, 17, 49, 50, 80} {
+		t.Run(fmt.Sprint(skip), func(t *testing.T) {
+			want := all[min(skip, len(all)):]
+			if got := ids(index, skip); !slices.Equal(got, want) {
+				t.Errorf("Ascend(%d) = %v, want %v", skip, got, want)
+			}
+		})
+	}
+
+	t.Run("stops early", func(t *testing.T) {
+		var got []string
+		index.Ascend(10, func(s GameScore) bool {
+			got = append(got, s.ID)
+			return len(got) < 3
+		})
+		if want := all[10:13]; !slices.Equal(got, want) {
+			t.Errorf("Ascend(10) = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRankedIndexDelete(t *testing.T) {
+	index := newRankedIndex()
+	scores := make([]GameScore, 20)
+	for i := range scores {
+		scores[i] = testScore(fmt.Sprintf("s%02d", i), 1000-i)
+		index.Insert(scores[i])
+	}
+	if !index.Delete(scores[5]) {
+		t.Fatal("Delete() of a present score = false")
+	}
+	if index.Delete(scores[5]) {
+		t.Error("Delete() of a removed score = true")
+	}
+	if index.Delete(testScore("missing", 995)) {
+		t.Error("Delete() of an unknown score = true")
+	}
+	if index.Len() != 19 {
+		t.Errorf("Len() = %d, want 19", index.Len())
+	}
+	if got := index.Rank(scores[6]); got != 6 {
+		t.Errorf("Rank() after delete = %d, want 6", got)
+	}
+	if got := ids(index, 4)[:2]; !slices.Equal(got, []string{"s04", "s06"}) {
+		t.Errorf("order after delete = %v", got)
+	}
+}
+
+// benchScores returns n scores with random points and distinct IDs
+func benchScores(n int) []GameScore {
+	scores := make([]GameScore, n)
+	for i := range scores {
+		scores[i] = testScore(fmt.Sprintf("s%d", i), mrand.IntN(10000))
+		scores[i].Timestamp = time.Unix(int64(i), 0)
+	}
+	return scores
+}
+
+func BenchmarkRankedIndexInsert(b *testing.B) {
+	scores := benchScores(b.N)
+	index := newRankedIndex()
+	b.ResetTimer()
+	for i := range b.N {
+		index.Insert(scores[i])
+	}
+}
+
+func BenchmarkRankedIndexRank(b *testing.B) {
+	index := newRankedIndex()
+	for _, s := range benchScores(100000) {
+		index.Insert(s)
+	}
+	probes := benchScores(1024)
+	b.ResetTimer()
+	for i := range b.N {
+		index.Rank(probes[i%len(probes)])
+	}
+}
+
+func BenchmarkRankedIndexDelete(b *testing.B) {
+	scores := benchScores(b.N)
+	index := newRankedIndex()
+	for _, s := range scores {
+		index.Insert(s)
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		index.Delete(scores[i])
+	}
+}
+
+// BenchmarkMemoryStoreAddParallel submits scores from every CPU at once,
+// ranking each as a submission does
+func BenchmarkMemoryStoreAddParallel(b *testing.B) {
+	s := newMemoryStore(time.Hour)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			score := testScore("", mrand.IntN(10000))
+			score.Timestamp = time.Now()
+			added, err := s.Add(score)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := s.Rank(added); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at a steady rate up to its burst size
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key. A nil limiter allows everything.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter allows rate requests per second per key with bursts of up
+// to burst, or returns nil when rate is not positive
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from key's bucket, or reports how long until one
+// is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets buckets that have refilled, which behave like new ones.
+// Callers must hold mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// requestLimits throttles a handler per client IP and per signed-in
+// player, and caps how many requests it serves at once
+type requestLimits struct {
+	perIP     *rateLimiter
+	perPlayer *rateLimiter
+	// slots holds a token per request in flight; nil means no cap
+	slots chan struct{}
+	// methods lists the methods limited, or every method when empty
+	methods []string
+	// onReject, if set, also records why a request was turned away
+	onReject func(r *http.Request, reason string)
+}
+
+// newSlots makes the channel capping requests in flight at n, or nil for
+// no cap
+func newSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// newScoreLimits builds the score submission limits from cfg
+func newScoreLimits(cfg *Config) *requestLimits {
+	return &requestLimits{
+		perIP:     newRateLimiter(cfg.ScoreIPRate, cfg.ScoreIPBurst),
+		perPlayer: newRateLimiter(cfg.ScorePlayerRate, cfg.ScorePlayerBurst),
+		slots:     newSlots(cfg.ScoreConcurrency),
+		onReject:  rejectScore,
+	}
+}
+
+// newAuthLimits builds the limits on registering and signing in from cfg.
+// Each hashes a password, which is slow on purpose, so these are shared
+// by both routes and only apply to POSTs.
+func newAuthLimits(cfg *Config) *requestLimits {
+	return &requestLimits{
+		perIP:   newRateLimiter(cfg.AuthIPRate, cfg.AuthIPBurst),
+		slots:   newSlots(cfg.AuthConcurrency),
+		methods: []string{http.MethodPost},
+	}
+}
+
+// newGameLimits builds the limits on starting games and opening rooms
+// from cfg. Each holds server memory until it finishes or expires.
+func newGameLimits(cfg *Config) *requestLimits {
+	return &requestLimits{
+		perIP:   newRateLimiter(cfg.GameIPRate, cfg.GameIPBurst),
+		methods: []string{http.MethodPost},
+	}
+}
+
+// newDeckLimits builds the limits on uploading decks, which write to disk.
+// Uploads are opt-in, so these are fixed rather than configured.
+func newDeckLimits() *requestLimits {
+	return &requestLimits{
+		perIP:     newRateLimiter(1.0/60, 5),
+		perPlayer: newRateLimiter(1.0/60, 5),
+		slots:     newSlots(2),
+		methods:   []string{http.MethodPost},
+	}
+}
+
+// Where clientIP finds the client's address behind a proxy. The header is
+// only believed on requests from a trusted proxy.
+var (
+	clientIPHeader string
+	trustedProxies []netip.Prefix
+)
+
+// parseProxies reads a comma-separated list of IPs and CIDR ranges
+func parseProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// trustedProxy reports whether an address belongs to a trusted proxy
+func trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(trustedProxies, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// clientIP returns the address of the client behind a request. Requests
+// from trusted proxies are traced back through clientIPHeader, from the
+// nearest hop, to the first address that isn't another trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if clientIPHeader == "" || !trustedProxy(host) {
+		return host
+	}
+	var hops []string
+	for _, v := range r.Header.Values(clientIPHeader) {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// Anything further along was written by whoever sent this
+			break
+		}
+		host = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// reject counts a turned away request and responds with status and a
+// Retry-After of at least a second
+func (rl *requestLimits) reject(w http.ResponseWriter, r *http.Request, reason string, status int, wait time.Duration) {
+	rateLimited.inc(r.Pattern, reason)
+	if rl.onReject != nil {
+		rl.onReject(r, reason)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	http.Error(w, http.StatusText(status), status)
+}
+
+// wrap applies the limits in front of next. Guests are only limited by IP,
+// since their name is not known until the body is read.
+func (rl *requestLimits) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(rl.methods) > 0 && !slices.Contains(rl.methods, r.Method) {
+			next(w, r)
+			return
+		}
+		now := time.Now()
+		if ok, wait := rl.perIP.allow(clientIP(r), now); !ok {
+			rl.reject(w, r, "ip", http.StatusTooManyRequests, wait)
+			return
+		}
+		if s, ok := sessionFrom(r); ok {
+			if ok, wait := rl.perPlayer.allow(s.AccountID, now); !ok {
+				rl.reject(w, r, "player", http.StatusTooManyRequests, wait)
+				return
+			}
+		}
+
+		if rl.slots != nil {
+			select {
+			case rl.slots <- struct{}{}:
+				defer func() { <-rl.slots }()
+			default:
+				rl.reject(w, r, "concurrency", http.StatusServiceUnavailable, time.Second)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
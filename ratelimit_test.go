@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Unix(1000, 0)
+	for i := range 3 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms at 2 per second", wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another key shared the exhausted bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(wait)); !ok {
+		t.Error("request after waiting was refused")
+	}
+	if ok, _ := l.allow("a", now.Add(wait)); ok {
+		t.Error("refill went beyond the time waited")
+	}
+
+	// A full bucket is forgotten on the next sweep
+	later := now.Add(2 * time.Minute)
+	l.allow("c", later)
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("refilled bucket survived the sweep")
+	}
+
+	disabled := newRateLimiter(0, 1)
+	if ok, _ := disabled.allow("a", now); !ok {
+		t.Error("disabled limiter refused a request")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no header configured", "", "10.1.2.3:4000", []string{"203.0.113.9"}, "10.1.2.3"},
+		{"direct client", "X-Forwarded-For", "198.51.100.7:4000", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"one proxy", "X-Forwarded-For", "10.1.2.3:4000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"spoofed hop ignored", "X-Forwarded-For", "10.1.2.3:4000", []string{"1.1.1.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chained proxies", "X-Forwarded-For", "10.1.2.3:4000", []string{"203.0.113.9, 192.0.2.1", "10.9.9.9"}, "203.0.113.9"},
+		{"garbage stops the walk", "X-Forwarded-For", "10.1.2.3:4000", []string{"203.0.113.9, junk, 10.9.9.9"}, "10.9.9.9"},
+		{"missing header", "X-Forwarded-For", "10.1.2.3:4000", nil, "10.1.2.3"},
+		{"single value header", "X-Real-IP", "192.0.2.1:4000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"ipv6 client", "X-Forwarded-For", "10.1.2.3:4000", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	t.Cleanup(func() { clientIPHeader, trustedProxies = "", nil })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientIPHeader, trustedProxies = tt.header, proxies
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add(tt.header, v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProxiesRejectsGarbage(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/33", "proxy.local", "10.0.0.1/8/8"} {
+		if _, err := parseProxies(s); err == nil {
+			t.Errorf("parseProxies(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRequestLimitsMethods(t *testing.T) {
+	rl := &requestLimits{perIP: newRateLimiter(1, 1), methods: []string{http.MethodPost}}
+	h := rl.wrap(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(method string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/api/game", nil)
+		r.Pattern = "/api/game"
+		h(w, r)
+		return w.Code
+	}
+	limited := func() float64 {
+		rateLimited.mu.Lock()
+		defer rateLimited.mu.Unlock()
+		return rateLimited.values[labelPairs(rateLimited.labels, []string{"/api/game", "ip"})]
+	}
+	before := limited()
+	if code := serve(http.MethodPost); code != http.StatusOK {
+		t.Fatalf("first POST = %d", code)
+	}
+	if code := serve(http.MethodPost); code != http.StatusTooManyRequests {
+		t.Errorf("second POST = %d, want 429", code)
+	}
+	if n := limited() - before; n != 1 {
+		t.Errorf("rate limited counter rose by %v, want 1", n)
+	}
+	if code := serve(http.MethodGet); code != http.StatusOK {
+		t.Errorf("GET = %d, want it unlimited", code)
+	}
+}
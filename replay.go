@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var errReplayNotFound = errors.New("replay not found")
+
+// Replay is the record of a finished game: the deck as it was laid out and
+// every flip in order, so the game can be played back move by move
+type Replay struct {
+	ScoreID string   `json:"scoreId"`
+	Deck    []string `json:"deck"`
+	Flips   []Flip   `json:"flips"`
+}
+
+// replay captures a finished session for storage under its score's ID
+func (g *GameSession) replay() Replay {
+	return Replay{ScoreID: g.ID, Deck: slices.Clone(g.Deck), Flips: slices.Clone(g.Flips)}
+}
+
+// handleReplay serves a recorded game along with the score it earned
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	score, err := store.Score(id)
+	if errors.Is(err, errScoreNotFound) {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to load replay", err)
+		return
+	}
+	// Everyone plays the same daily deck, so showing it early would give
+	// the layout away
+	if score.Daily != "" && score.Daily >= dailyDate(time.Now()) {
+		http.Error(w, "Replay available once the challenge ends", http.StatusForbidden)
+		return
+	}
+	replay, err := store.Replay(id)
+	if errors.Is(err, errReplayNotFound) {
+		// Scores from before replays were recorded have none
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to load replay", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Score GameScore `json:"score"`
+		Replay
+	}{score, replay})
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	roomMinPlayers = 2
+	roomMaxPlayers = 4
+	// roomCodeLength is the number of characters in a room code
+	roomCodeLength = 5
+	// roomHideDelay is how long a mismatched pair stays visible
+	roomHideDelay = time.Second
+	// roomSendBuffer is how many messages a player may fall behind before eviction
+	roomSendBuffer = 16
+)
+
+// roomCodeAlphabet leaves out letters easily mistaken for digits
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// Room states
+const (
+	roomWaiting  = "waiting"
+	roomPlaying  = "playing"
+	roomFinished = "finished"
+)
+
+var (
+	errRoomFull    = errors.New("Room is full")
+	errRoomStarted = errors.New("Room has already started")
+)
+
+// MatchPlayer is one player's result in a multiplayer match
+type MatchPlayer struct {
+	Name     string `json:"name"`
+	PlayerID string `json:"playerId,omitempty"`
+	Pairs    int    `json:"pairs"`
+	Moves    int    `json:"moves"`
+	// Won is set for the match's winners; matches recorded before it was
+	// added only list winners by name
+	Won bool `json:"won,omitempty"`
+}
+
+// MatchResult records a finished multiplayer match
+type MatchResult struct {
+	ID         string        `json:"id"`
+	Code       string        `json:"code"`
+	Difficulty string        `json:"difficulty"`
+	Pairs      int           `json:"pairs"`
+	Players    []MatchPlayer `json:"players"`
+	Winners    []string      `json:"winners"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+}
+
+// roomPlayer is a connected seat in a room
+type roomPlayer struct {
+	ID        string
+	Name      string
+	PlayerID  string
+	Pairs     int
+	Moves     int
+	connected bool
+	send      chan []byte
+}
+
+// Room is a shared board that players take turns on. The embedded game
+// session supplies the deck and flip rules; it is guarded by mu rather
+// than gamesMu since it is never registered in games.
+type Room struct {
+	mu         sync.Mutex
+	Code       string
+	difficulty Difficulty
+	game       *GameSession
+	players    []*roomPlayer
+	turn       int
+	state      string
+	hiding     bool
+	winners    []string
+}
+
+var (
+	rooms   = make(map[string]*Room)
+	roomsMu sync.Mutex
+)
+
+// newRoomCode returns a random code not used by any open room.
+// Callers must hold roomsMu.
+func newRoomCode() string {
+	b := make([]byte, roomCodeLength)
+	for {
+		for i := range b {
+			b[i] = roomCodeAlphabet[mrand.IntN(len(roomCodeAlphabet))]
+		}
+		if _, ok := rooms[string(b)]; !ok {
+			return string(b)
+		}
+	}
+}
+
+// newRoom opens a room for the given difficulty
+func newRoom(difficulty Difficulty) *Room {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+
+	deck, _ := deckByID(defaultDeck)
+	room := &Room{
+		Code:       newRoomCode(),
+		difficulty: difficulty,
+		game:       newGameSession("", "", difficulty, deck),
+		state:      roomWaiting,
+	}
+	rooms[room.Code] = room
+	return room
+}
+
+// join seats a new player while the room is still waiting
+func (room *Room) join(name, playerID string) (*roomPlayer, error) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if room.state != roomWaiting {
+		return nil, errRoomStarted
+	}
+	if len(room.players) >= roomMaxPlayers {
+		return nil, errRoomFull
+	}
+	p := &roomPlayer{
+		ID:        newID(),
+		Name:      name,
+		PlayerID:  playerID,
+		connected: true,
+		send:      make(chan []byte, roomSendBuffer),
+	}
+	room.players = append(room.players, p)
+	room.broadcast()
+	return p, nil
+}
+
+// leave marks a player disconnected, passing the turn on if it was theirs,
+// and closes the room once nobody is left
+func (room *Room) leave(p *roomPlayer) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.disconnect(p)
+	if room.state == roomWaiting {
+		// Free the seat so someone else can take it
+		room.players = slices.DeleteFunc(room.players, func(other *roomPlayer) bool { return other == p })
+	}
+	if room.state == roomPlaying && room.players[room.turn] == p && !room.hiding {
+		room.game.faceUp = room.game.faceUp[:0]
+		room.advanceTurn()
+	}
+
+	if !slices.ContainsFunc(room.players, func(other *roomPlayer) bool { return other.connected }) {
+		roomsMu.Lock()
+		delete(rooms, room.Code)
+		roomsMu.Unlock()
+		return
+	}
+	room.broadcast()
+}
+
+// disconnect closes a player's outgoing channel. Callers must hold mu.
+func (room *Room) disconnect(p *roomPlayer) {
+	if p.connected {
+		p.connected = false
+		close(p.send)
+	}
+}
+
+// start begins play once enough players have joined. Only the first
+// player to join, the host, may start.
+func (room *Room) start(p *roomPlayer) error {
+	if room.state != roomWaiting {
+		return errRoomStarted
+	}
+	if room.players[0] != p {
+		return errors.New("Only the host can start the game")
+	}
+	if len(room.players) < roomMinPlayers {
+		return errors.New("Waiting for more players")
+	}
+	room.state = roomPlaying
+	room.turn = 0
+	return nil
+}
+
+// flip turns a card for the player whose turn it is. A match keeps the
+// turn; a miss hands it on after roomHideDelay.
+func (room *Room) flip(p *roomPlayer, index int) error {
+	if room.state != roomPlaying {
+		return errors.New("Game is not in progress")
+	}
+	if room.players[room.turn] != p {
+		return errors.New("Not your turn")
+	}
+	if room.hiding {
+		return errors.New("Wait for the cards to turn back")
+	}
+
+	res, err := room.game.flip(index, time.Now())
+	if err != nil {
+		return err
+	}
+	if res.Pair == nil {
+		return nil
+	}
+	p.Moves++
+	if res.Matched {
+		p.Pairs++
+	} else {
+		room.hiding = true
+		time.AfterFunc(roomHideDelay, func() {
+			room.mu.Lock()
+			defer room.mu.Unlock()
+			room.hiding = false
+			room.game.faceUp = room.game.faceUp[:0]
+			room.advanceTurn()
+			room.broadcast()
+		})
+	}
+	if res.Finished {
+		room.finish()
+	}
+	return nil
+}
+
+// advanceTurn passes the turn to the next connected player. Callers must hold mu.
+func (room *Room) advanceTurn() {
+	for range room.players {
+		room.turn = (room.turn + 1) % len(room.players)
+		if room.players[room.turn].connected {
+			return
+		}
+	}
+}
+
+// finish declares the players with the most pairs winners and records the
+// match. Callers must hold mu.
+func (room *Room) finish() {
+	room.state = roomFinished
+
+	best := 0
+	for _, p := range room.players {
+		best = max(best, p.Pairs)
+	}
+	result := MatchResult{
+		ID:         room.game.ID,
+		Code:       room.Code,
+		Difficulty: room.difficulty.Name,
+		Pairs:      room.difficulty.Pairs,
+		StartedAt:  room.game.StartedAt,
+		FinishedAt: room.game.FinishedAt,
+	}
+	for _, p := range room.players {
+		won := p.Pairs == best
+		result.Players = append(result.Players, MatchPlayer{Name: p.Name, PlayerID: p.PlayerID, Pairs: p.Pairs, Moves: p.Moves, Won: won})
+		if won {
+			result.Winners = append(result.Winners, p.Name)
+		}
+	}
+	room.winners = result.Winners
+
+	if err := store.AddMatch(result); err != nil {
+		slog.Error("Failed to save match", "match", result.ID, "err", err)
+	}
+}
+
+// roomState is the view of a room sent to every player
+type roomState struct {
+	Type       string            `json:"type"`
+	Code       string            `json:"code"`
+	Difficulty string            `json:"difficulty"`
+	State      string            `json:"state"`
+	Cards      []string          `json:"cards"`
+	FaceUp     []int             `json:"faceUp"`
+	Players    []roomPlayerState `json:"players"`
+	Turn       int               `json:"turn"`
+	Winners    []string          `json:"winners,omitempty"`
+}
+
+type roomPlayerState struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Pairs     int    `json:"pairs"`
+	Moves     int    `json:"moves"`
+	Connected bool   `json:"connected"`
+}
+
+// broadcast sends the current state to every connected player, evicting
+// any that have fallen too far behind. Callers must hold mu.
+func (room *Room) broadcast() {
+	g := room.game
+	state := roomState{
+		Type:       "state",
+		Code:       room.Code,
+		Difficulty: room.difficulty.Name,
+		State:      room.state,
+		Cards:      make([]string, len(g.Deck)),
+		FaceUp:     slices.Clone(g.faceUp),
+		Turn:       room.turn,
+		Winners:    room.winners,
+	}
+	for i, face := range g.Deck {
+		if g.matched[i] {
+			state.Cards[i] = face
+		}
+	}
+	for _, i := range state.FaceUp {
+		state.Cards[i] = g.Deck[i]
+	}
+	for _, p := range room.players {
+		state.Players = append(state.Players, roomPlayerState{
+			ID: p.ID, Name: p.Name, Pairs: p.Pairs, Moves: p.Moves, Connected: p.connected,
+		})
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		slog.Error("Failed to encode room state", "room", room.Code, "err", err)
+		return
+	}
+	for _, p := range room.players {
+		if !p.connected {
+			continue
+		}
+		select {
+		case p.send <- data:
+		default:
+			room.disconnect(p)
+		}
+	}
+}
+
+// roomMessage is a message from a player
+type roomMessage struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+// handle applies a player's message, replying with an error on failure
+func (room *Room) handle(p *roomPlayer, msg roomMessage) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if !p.connected {
+		return
+	}
+	var err error
+	switch msg.Type {
+	case "start":
+		err = room.start(p)
+	case "flip":
+		err = room.flip(p, msg.Index)
+	default:
+		err = errors.New("Unknown message type")
+	}
+	if err != nil {
+		sendRoomError(p, err)
+		return
+	}
+	room.broadcast()
+}
+
+// sendRoomError queues an error message for one player. Callers must hold mu.
+func sendRoomError(p *roomPlayer, err error) {
+	if !p.connected {
+		return
+	}
+	data, _ := json.Marshal(map[string]string{"type": "error", "message": err.Error()})
+	select {
+	case p.send <- data:
+	default:
+	}
+}
+
+// writeRoomMessages delivers queued messages and keep-alive pings until the
+// player is disconnected
+func writeRoomMessages(conn *wsConn, send <-chan []byte) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case data, ok := <-send:
+			if !ok {
+				return
+			}
+			if conn.WriteMessage(data) != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.Ping() != nil {
+				return
+			}
+		}
+	}
+}
+
+// reapRooms closes rooms older than cutoff that nobody is connected to
+func reapRooms(cutoff time.Time) {
+	roomsMu.Lock()
+	open := make([]*Room, 0, len(rooms))
+	for _, room := range rooms {
+		open = append(open, room)
+	}
+	roomsMu.Unlock()
+
+	for _, room := range open {
+		room.mu.Lock()
+		idle := room.game.CreatedAt.Before(cutoff) &&
+			!slices.ContainsFunc(room.players, func(p *roomPlayer) bool { return p.connected })
+		room.mu.Unlock()
+		if idle {
+			roomsMu.Lock()
+			delete(rooms, room.Code)
+			roomsMu.Unlock()
+		}
+	}
+}
+
+func handleNewRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Difficulty string `json:"difficulty"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	difficulty, ok := difficultyByName(req.Difficulty)
+	if !ok {
+		verr := &ValidationError{}
+		verr.add("difficulty", "unknown difficulty %q", req.Difficulty)
+		writeValidationError(w, verr)
+		return
+	}
+
+	room := newRoom(difficulty)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"code":       room.Code,
+		"difficulty": difficulty.Name,
+		"pairs":      difficulty.Pairs,
+	})
+}
+
+func handleRoomSocket(w http.ResponseWriter, r *http.Request) {
+	roomsMu.Lock()
+	room, ok := rooms[r.PathValue("code")]
+	roomsMu.Unlock()
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	verr := &ValidationError{}
+	name, playerID := playerFor(r, r.URL.Query().Get("playerName"), verr)
+	if err := verr.err(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	p, err := room.join(name, playerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		room.leave(p)
+		return
+	}
+
+	welcome, _ := json.Marshal(map[string]string{"type": "welcome", "playerId": p.ID})
+	conn.WriteMessage(welcome)
+	go writeRoomMessages(conn, p.send)
+
+	defer room.leave(p)
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg roomMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			room.mu.Lock()
+			sendRoomError(p, errors.New("Invalid message"))
+			room.mu.Unlock()
+			continue
+		}
+		room.handle(p, msg)
+	}
+}
+
+func handleMatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 100)
+	}
+	matches, err := store.Matches(limit)
+	if err != nil {
+		serverError(w, r, "Failed to load matches", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Scorer turns a finished game into leaderboard points. Higher is better.
+type Scorer interface {
+	Score(s GameScore) int
+}
+
+// scorers are the formulas selectable with -scoring
+var scorers = map[string]Scorer{
+	"composite": compositeScorer{},
+	"moves":     movesScorer{},
+}
+
+// scorer awards the points of new games
+var scorer Scorer = compositeScorer{}
+
+// scorerNames lists the selectable formulas for help and error messages
+func scorerNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(scorers)), ", ")
+}
+
+const (
+	// pointsPerPair is what a flawless game earns for each pair
+	pointsPerPair = 1000
+	// parSecondsPerPair is how fast a strong player clears a pair
+	parSecondsPerPair = 4
+	// comboPoints is the bonus for each match in a row after the first
+	comboPoints = 50
+)
+
+// compositeScorer weighs accuracy (pairs per move) and speed (par time over
+// time taken) together, so a slow game can't win on one fewer move, and adds
+// a bonus for the longest run of consecutive matches
+type compositeScorer struct{}
+
+func (compositeScorer) Score(s GameScore) int {
+	if s.Moves == 0 {
+		return 0
+	}
+	accuracy := float64(s.Pairs) / float64(s.Moves)
+	par := float64(s.Pairs * parSecondsPerPair)
+	speed := par / max(par, s.TimeTaken)
+	points := float64(s.Pairs*pointsPerPair) * (0.6*accuracy + 0.4*speed)
+	return int(math.Round(points)) + max(s.Combo-1, 0)*comboPoints
+}
+
+// movesScorer ranks by moves alone, as the original leaderboard did, with
+// each move beyond a perfect game costing a tenth of a pair's points
+type movesScorer struct{}
+
+func (movesScorer) Score(s GameScore) int {
+	return max(0, s.Pairs*pointsPerPair-(s.Moves-s.Pairs)*pointsPerPair/10)
+}
@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// Registers the "sqlite3" database/sql driver used by the sqlite store
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,938 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errScoreNotFound = errors.New("score not found")
+
+// ScoreStore persists submitted scores and serves them in leaderboard order,
+// along with their replays, multiplayer matches, player accounts and
+// achievements
+type ScoreStore interface {
+	// Add stores a score, assigning an ID if it has none
+	Add(score GameScore) (GameScore, error)
+	// Top returns the best n scores for a difficulty, or all of them when n <= 0
+	Top(difficulty string, n int) ([]GameScore, error)
+	// Query returns the scores matching q in leaderboard order, or the
+	// order q.Sort names
+	Query(q ScoreQuery) ([]GameScore, error)
+	// Count returns how many scores match q, ignoring its pagination
+	Count(q ScoreQuery) (int, error)
+	// Rank returns the 1-based position score holds, or would hold, on its
+	// difficulty's leaderboard along with the number of scores ranked there
+	Rank(score GameScore) (rank, total int, err error)
+	// Score looks a score up by ID
+	Score(id string) (GameScore, error)
+	// Delete removes the score with the given ID, and its replay
+	Delete(id string) error
+	// PlayerScores returns every score a player submitted, newest first.
+	// A registered player is found by account ID, a guest by name.
+	PlayerScores(name, id string) ([]GameScore, error)
+	// Rescore recomputes every score's points, reordering the leaderboards,
+	// and returns how many changed
+	Rescore(points func(GameScore) int) (int, error)
+	// AddReplay records how a game was played, keyed by its score's ID
+	AddReplay(r Replay) error
+	// Replay returns the recording of a score's game
+	Replay(scoreID string) (Replay, error)
+	// DailyWinners returns the best score of each daily challenge, newest
+	// day first, up to limit days
+	DailyWinners(limit int) ([]GameScore, error)
+	// AddMatch records a finished multiplayer match
+	AddMatch(m MatchResult) error
+	// Matches returns the most recent matches, newest first, up to limit
+	Matches(limit int) ([]MatchResult, error)
+	// AddAccount registers an account, failing with errAccountExists if
+	// its name is taken regardless of case
+	AddAccount(a Account) error
+	// Account looks an account up by name, ignoring case
+	Account(name string) (Account, error)
+	// AddUnlocks records achievements earned, skipping any the player
+	// already holds, and returns those that were new
+	AddUnlocks(unlocks []Unlock) ([]Unlock, error)
+	// Unlocks returns the achievements a player has earned, oldest first,
+	// finding the player as PlayerScores does
+	Unlocks(name, id string) ([]Unlock, error)
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+	// Close flushes and releases the store
+	Close() error
+}
+
+// ScoreQuery filters scores returned by ScoreStore.Query. Daily selects a
+// day's challenge board; when empty only regular games match. Deck picks
+// a difficulty's board for one deck, the default deck when empty.
+// PlayerName and PlayerID pick one player's scores, as PlayerScores does.
+// Flagged keeps only scores verification flagged.
+// After continues from a score on a previous page, in the query's sort
+// order.
+type ScoreQuery struct {
+	Difficulty   string
+	Deck         string
+	Daily        string
+	PlayerName   string
+	PlayerID     string
+	PlayerPrefix string
+	Flagged      bool
+	Since        time.Time
+	Until        time.Time
+	Sort         string
+	After        *GameScore
+	Offset       int
+	Limit        int
+}
+
+// Score sort orders. The default ranks by points.
+const (
+	sortScore = "score"
+	sortMoves = "moves"
+	sortTime  = "time"
+)
+
+// scoreSorts maps each sort order to its comparator
+var scoreSorts = map[string]func(a, b GameScore) int{
+	sortScore: compareScores,
+	sortMoves: compareByMoves,
+	sortTime:  compareByTime,
+}
+
+// compare returns the comparator for the query's sort order
+func (q ScoreQuery) compare() func(a, b GameScore) int {
+	if c, ok := scoreSorts[q.Sort]; ok {
+		return c
+	}
+	return compareScores
+}
+
+// match reports whether s passes the query's filters
+func (q ScoreQuery) match(s GameScore) bool {
+	if q.Difficulty != "" && (s.Difficulty != q.Difficulty || s.Deck != cmp.Or(q.Deck, defaultDeck)) {
+		return false
+	}
+	if s.Daily != q.Daily {
+		return false
+	}
+	if (q.PlayerName != "" || q.PlayerID != "") && playerKey(s.PlayerName, s.PlayerID) != playerKey(q.PlayerName, q.PlayerID) {
+		return false
+	}
+	if q.Flagged && s.Flag == "" {
+		return false
+	}
+	if q.PlayerPrefix != "" && !strings.HasPrefix(accountKey(s.PlayerName), accountKey(q.PlayerPrefix)) {
+		return false
+	}
+	if !q.Since.IsZero() && s.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !s.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// filtered reports whether q narrows results beyond a difficulty
+func (q ScoreQuery) filtered() bool {
+	return q.PlayerName != "" || q.PlayerID != "" || q.PlayerPrefix != "" || q.Flagged || !q.Since.IsZero() || !q.Until.IsZero()
+}
+
+// ranked reports whether q reads scores in leaderboard order
+func (q ScoreQuery) ranked() bool {
+	return q.Sort == "" || q.Sort == sortScore
+}
+
+// openStore builds the ScoreStore selected by kind
+func openStore(kind, path string, history time.Duration) (ScoreStore, error) {
+	switch kind {
+	case "memory":
+		return newMemoryStore(history), nil
+	case "file":
+		return openFileStore(cmp.Or(path, "scores.jsonl"), history)
+	case "sqlite":
+		return openSQLStore("sqlite3", cmp.Or(path, "scores.db"))
+	}
+	return nil, fmt.Errorf("unknown store %q", kind)
+}
+
+// playerKey names whose scores and achievements are whose: the account
+// for registered players, so nobody inherits a guest's history by
+// registering their name, and the name for guests
+func playerKey(name, id string) string {
+	if id != "" {
+		return "account:" + id
+	}
+	return "guest:" + name
+}
+
+// boardKey names the leaderboard a score ranks on: its difficulty and
+// deck, or its day for daily challenges
+func boardKey(difficulty, deck, daily string) string {
+	if daily != "" {
+		return "daily:" + daily
+	}
+	if deck != "" && deck != defaultDeck {
+		return difficulty + "/" + deck
+	}
+	return difficulty
+}
+
+// memoryStore ranks every score on its leaderboard's index. So that
+// windowed leaderboards don't scan all time, scores from the last history
+// are also ranked in a second index.
+type memoryStore struct {
+	mu       sync.RWMutex
+	history  time.Duration
+	boards   map[string]*rankedIndex
+	recent   map[string]*rankedIndex
+	expiry   []GameScore
+	byID     map[string]GameScore
+	players  map[string][]GameScore
+	matches  []MatchResult
+	accounts map[string]Account
+	unlocks  map[string][]Unlock
+	replays  map[string]Replay
+}
+
+func newMemoryStore(history time.Duration) *memoryStore {
+	return &memoryStore{
+		history:  history,
+		boards:   make(map[string]*rankedIndex),
+		recent:   make(map[string]*rankedIndex),
+		byID:     make(map[string]GameScore),
+		players:  make(map[string][]GameScore),
+		accounts: make(map[string]Account),
+		unlocks:  make(map[string][]Unlock),
+		replays:  make(map[string]Replay),
+	}
+}
+
+// keepsHistory reports whether recent scores are indexed separately
+func (m *memoryStore) keepsHistory() bool {
+	return m.history > 0
+}
+
+func (m *memoryStore) Add(score GameScore) (GameScore, error) {
+	if score.ID == "" {
+		score.ID = newID()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insert(score)
+	return score, nil
+}
+
+// insert records a score in its player's history and ranks it on its
+// difficulty's board. Callers must hold mu.
+func (m *memoryStore) insert(score GameScore) {
+	key := boardKey(score.Difficulty, score.Deck, score.Daily)
+	board, ok := m.boards[key]
+	if !ok {
+		board = newRankedIndex()
+		m.boards[key] = board
+	}
+	m.byID[score.ID] = score
+	player := playerKey(score.PlayerName, score.PlayerID)
+	m.players[player] = append(m.players[player], score)
+	board.Insert(score)
+
+	if m.keepsHistory() {
+		now := time.Now()
+		if score.Timestamp.After(now.Add(-m.history)) {
+			recent, ok := m.recent[key]
+			if !ok {
+				recent = newRankedIndex()
+				m.recent[key] = recent
+			}
+			recent.Insert(score)
+			m.expiry = append(m.expiry, score)
+		}
+		m.expire(now)
+	}
+}
+
+// expire drops scores older than history from the recent indexes. Scores
+// arrive in roughly time order, so expiry stops at the first recent one.
+// Callers must hold mu.
+func (m *memoryStore) expire(now time.Time) {
+	cutoff := now.Add(-m.history)
+	n := 0
+	for n < len(m.expiry) && m.expiry[n].Timestamp.Before(cutoff) {
+		s := m.expiry[n]
+		m.recent[boardKey(s.Difficulty, s.Deck, s.Daily)].Delete(s)
+		n++
+	}
+	m.expiry = slices.Delete(m.expiry, 0, n)
+}
+
+// remove drops the score with the given ID. Callers must hold mu.
+func (m *memoryStore) remove(id string) bool {
+	score, ok := m.byID[id]
+	if !ok {
+		return false
+	}
+	delete(m.byID, id)
+	delete(m.replays, id)
+	player := playerKey(score.PlayerName, score.PlayerID)
+	m.players[player] = slices.DeleteFunc(m.players[player], func(s GameScore) bool {
+		return s.ID == id
+	})
+	if len(m.players[player]) == 0 {
+		delete(m.players, player)
+	}
+	key := boardKey(score.Difficulty, score.Deck, score.Daily)
+	if recent, ok := m.recent[key]; ok {
+		recent.Delete(score)
+	}
+	m.boards[key].Delete(score)
+	return true
+}
+
+func (m *memoryStore) PlayerScores(name, id string) ([]GameScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := append([]GameScore{}, m.players[playerKey(name, id)]...)
+	slices.SortStableFunc(scores, func(a, b GameScore) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	return scores, nil
+}
+
+// all returns every score across difficulties in leaderboard order.
+// Callers must hold mu.
+func (m *memoryStore) all() []GameScore {
+	scores := make([]GameScore, 0, len(m.byID))
+	for _, s := range m.byID {
+		scores = append(scores, s)
+	}
+	slices.SortFunc(scores, compareScores)
+	return scores
+}
+
+func (m *memoryStore) Top(difficulty string, n int) ([]GameScore, error) {
+	return m.Query(ScoreQuery{Difficulty: difficulty, Limit: n})
+}
+
+// board returns the index holding every score q can match, or nil.
+// Callers must hold mu.
+func (m *memoryStore) board(q ScoreQuery) *rankedIndex {
+	key := boardKey(q.Difficulty, q.Deck, q.Daily)
+	// Windows within the history are served from the complete recent index
+	if m.keepsHistory() && !q.Since.IsZero() && !q.Since.Before(time.Now().Add(-m.history)) {
+		return m.recent[key]
+	}
+	return m.boards[key]
+}
+
+// candidates returns the scores q can match, unfiltered and unordered.
+// Callers must hold mu.
+func (m *memoryStore) candidates(q ScoreQuery) []GameScore {
+	if q.Difficulty == "" && q.Daily == "" {
+		return slices.Collect(maps.Values(m.byID))
+	}
+	board := m.board(q)
+	if board == nil {
+		return nil
+	}
+	scores := make([]GameScore, 0, board.Len())
+	board.Ascend(0, func(s GameScore) bool {
+		scores = append(scores, s)
+		return true
+	})
+	return scores
+}
+
+func (m *memoryStore) Query(q ScoreQuery) ([]GameScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	compare := q.compare()
+	result := []GameScore{}
+	skipped := 0
+	collect := func(s GameScore) bool {
+		if !q.match(s) || q.After != nil && compare(s, *q.After) <= 0 {
+			return true
+		}
+		if skipped < q.Offset {
+			skipped++
+			return true
+		}
+		result = append(result, s)
+		return q.Limit <= 0 || len(result) < q.Limit
+	}
+
+	// Boards are kept in leaderboard order; anything else is sorted here
+	if q.Difficulty == "" && q.Daily == "" || !q.ranked() {
+		for _, s := range slices.SortedFunc(slices.Values(m.candidates(q)), compare) {
+			if !collect(s) {
+				break
+			}
+		}
+		return result, nil
+	}
+
+	board := m.board(q)
+	if board == nil {
+		return result, nil
+	}
+	start := 0
+	switch {
+	case q.After != nil:
+		// Resume at the cursor's position, which holds even if it was deleted
+		start = board.Rank(*q.After) - 1
+	case !q.filtered():
+		// Without filters the offset can be skipped in O(log n)
+		start, skipped = q.Offset, q.Offset
+	}
+	board.Ascend(start, collect)
+	return result, nil
+}
+
+func (m *memoryStore) Count(q ScoreQuery) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if q.Difficulty != "" || q.Daily != "" {
+		board := m.board(q)
+		if board == nil {
+			return 0, nil
+		}
+		if !q.filtered() {
+			return board.Len(), nil
+		}
+	}
+	n := 0
+	for _, s := range m.candidates(q) {
+		if q.match(s) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) Rank(score GameScore) (int, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	board, ok := m.boards[boardKey(score.Difficulty, score.Deck, score.Daily)]
+	if !ok {
+		return 1, 0, nil
+	}
+	return board.Rank(score), board.Len(), nil
+}
+
+func (m *memoryStore) Score(id string) (GameScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	score, ok := m.byID[id]
+	if !ok {
+		return GameScore{}, errScoreNotFound
+	}
+	return score, nil
+}
+
+func (m *memoryStore) AddReplay(r Replay) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replays[r.ScoreID] = r
+	return nil
+}
+
+func (m *memoryStore) Replay(scoreID string) (Replay, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.replays[scoreID]
+	if !ok {
+		return Replay{}, errReplayNotFound
+	}
+	return r, nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.remove(id) {
+		return errScoreNotFound
+	}
+	return nil
+}
+
+func (m *memoryStore) Rescore(points func(GameScore) int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.rescore(points), nil
+}
+
+// rescore recomputes every score's points, rebuilding the indexes if any
+// changed. Callers must hold mu.
+func (m *memoryStore) rescore(points func(GameScore) int) int {
+	scores := m.all()
+	changed := 0
+	for i := range scores {
+		if p := points(scores[i]); p != scores[i].Score {
+			scores[i].Score = p
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0
+	}
+
+	m.boards = make(map[string]*rankedIndex)
+	m.recent = make(map[string]*rankedIndex)
+	m.expiry = nil
+	m.byID = make(map[string]GameScore)
+	m.players = make(map[string][]GameScore)
+	slices.SortStableFunc(scores, func(a, b GameScore) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	for _, s := range scores {
+		m.insert(s)
+	}
+	return changed
+}
+
+func (m *memoryStore) DailyWinners(limit int) ([]GameScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var days []string
+	for key := range m.boards {
+		if day, ok := strings.CutPrefix(key, "daily:"); ok {
+			days = append(days, day)
+		}
+	}
+	// Dates in YYYY-MM-DD form sort chronologically
+	slices.Sort(days)
+	slices.Reverse(days)
+
+	result := []GameScore{}
+	for _, day := range days {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		m.boards["daily:"+day].Ascend(0, func(s GameScore) bool {
+			result = append(result, s)
+			return false
+		})
+	}
+	return result, nil
+}
+
+func (m *memoryStore) AddMatch(match MatchResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertMatch(match)
+	return nil
+}
+
+// insertMatch appends a match. Callers must hold mu.
+func (m *memoryStore) insertMatch(match MatchResult) {
+	m.matches = append(m.matches, match)
+}
+
+func (m *memoryStore) Matches(limit int) ([]MatchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []MatchResult{}
+	for i := len(m.matches) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		result = append(result, m.matches[i])
+	}
+	return result, nil
+}
+
+func (m *memoryStore) AddAccount(a Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertAccount(a)
+}
+
+// insertAccount registers an account unless its name is taken.
+// Callers must hold mu.
+func (m *memoryStore) insertAccount(a Account) error {
+	key := accountKey(a.PlayerName)
+	if _, ok := m.accounts[key]; ok {
+		return errAccountExists
+	}
+	m.accounts[key] = a
+	return nil
+}
+
+func (m *memoryStore) Account(name string) (Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.accounts[accountKey(name)]
+	if !ok {
+		return Account{}, errAccountNotFound
+	}
+	return a, nil
+}
+
+func (m *memoryStore) AddUnlocks(unlocks []Unlock) ([]Unlock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.DeleteFunc(unlocks, func(u Unlock) bool { return !m.insertUnlock(u) }), nil
+}
+
+// insertUnlock records an achievement unless the player already holds it,
+// reporting whether it was new. Callers must hold mu.
+func (m *memoryStore) insertUnlock(u Unlock) bool {
+	player := playerKey(u.PlayerName, u.PlayerID)
+	held := m.unlocks[player]
+	if slices.ContainsFunc(held, func(h Unlock) bool { return h.AchievementID == u.AchievementID }) {
+		return false
+	}
+	m.unlocks[player] = append(held, u)
+	return true
+}
+
+func (m *memoryStore) Unlocks(name, id string) ([]Unlock, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]Unlock{}, m.unlocks[playerKey(name, id)]...), nil
+}
+
+// unlockCount returns how many achievements are held across all players.
+// Callers must hold mu.
+func (m *memoryStore) unlockCount() int {
+	n := 0
+	for _, held := range m.unlocks {
+		n += len(held)
+	}
+	return n
+}
+
+func (m *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// journalEntry is one line of the file store's append-only log
+type journalEntry struct {
+	Op      string       `json:"op"`
+	Score   *GameScore   `json:"score,omitempty"`
+	Match   *MatchResult `json:"match,omitempty"`
+	Account *Account     `json:"account,omitempty"`
+	Unlock  *Unlock      `json:"unlock,omitempty"`
+	Replay  *Replay      `json:"replay,omitempty"`
+	ID      string       `json:"id,omitempty"`
+}
+
+// compactMinEntries is the journal length below which compaction is skipped
+const compactMinEntries = 100
+
+// fileStore serves reads from memory and records every change as a line
+// of JSON in an append-only journal, rewriting it once dead entries pile up
+type fileStore struct {
+	*memoryStore
+
+	path    string
+	file    *os.File
+	entries int
+}
+
+func openFileStore(path string, history time.Duration) (*fileStore, error) {
+	fs := &fileStore{memoryStore: newMemoryStore(history), path: path}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	if err := fs.compact(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// load replays the journal into memory
+func (fs *fileStore) load() error {
+	f, err := os.Open(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	live := make(map[string]GameScore)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s: corrupt journal entry: %w", fs.path, err)
+		}
+		switch {
+		case e.Op == "add" && e.Score != nil:
+			// Scores from before accounts carry no guest flag, and those
+			// from before decks no deck
+			e.Score.Guest = e.Score.PlayerID == ""
+			e.Score.Deck = cmp.Or(e.Score.Deck, defaultDeck)
+			if _, ok := live[e.Score.ID]; !ok {
+				order = append(order, e.Score.ID)
+			}
+			live[e.Score.ID] = *e.Score
+		case e.Op == "delete":
+			delete(live, e.ID)
+			delete(fs.replays, e.ID)
+		case e.Op == "replay" && e.Replay != nil:
+			fs.replays[e.Replay.ScoreID] = *e.Replay
+		case e.Op == "match" && e.Match != nil:
+			fs.insertMatch(*e.Match)
+		case e.Op == "account" && e.Account != nil:
+			fs.insertAccount(*e.Account)
+		case e.Op == "unlock" && e.Unlock != nil:
+			// Unlocks from before they were kept per account belong to
+			// whoever submitted the game that earned them
+			if s, ok := live[e.Unlock.ScoreID]; ok && e.Unlock.PlayerID == "" {
+				e.Unlock.PlayerID = s.PlayerID
+			}
+			fs.insertUnlock(*e.Unlock)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Replay in time order so history expires oldest first
+	scores := make([]GameScore, 0, len(live))
+	for _, id := range order {
+		if s, ok := live[id]; ok {
+			scores = append(scores, s)
+		}
+	}
+	slices.SortStableFunc(scores, func(a, b GameScore) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	for _, s := range scores {
+		fs.insert(s)
+	}
+	return nil
+}
+
+// compact rewrites the journal with only the live scores and reopens it
+// for appending. Callers must hold mu or have exclusive access.
+func (fs *fileStore) compact() error {
+	tmp := fs.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	scores := fs.all()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range scores {
+		if err := enc.Encode(journalEntry{Op: "add", Score: &scores[i]}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, s := range scores {
+		r, ok := fs.replays[s.ID]
+		if !ok {
+			continue
+		}
+		if err := enc.Encode(journalEntry{Op: "replay", Replay: &r}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for i := range fs.matches {
+		if err := enc.Encode(journalEntry{Op: "match", Match: &fs.matches[i]}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, a := range fs.accounts {
+		if err := enc.Encode(journalEntry{Op: "account", Account: &a}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, held := range fs.unlocks {
+		for i := range held {
+			if err := enc.Encode(journalEntry{Op: "unlock", Unlock: &held[i]}); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fs.path); err != nil {
+		return err
+	}
+
+	if fs.file != nil {
+		fs.file.Close()
+	}
+	fs.file, err = os.OpenFile(fs.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	fs.entries = len(scores) + len(fs.replays) + len(fs.matches) + len(fs.accounts) + fs.unlockCount()
+	return err
+}
+
+// append writes one entry to the journal, compacting when more than half
+// of it is dead. Callers must hold mu.
+func (fs *fileStore) append(e journalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	fs.entries++
+
+	if fs.entries > compactMinEntries && fs.entries > 2*(len(fs.byID)+len(fs.replays)+len(fs.matches)+len(fs.accounts)+fs.unlockCount()) {
+		return fs.compact()
+	}
+	return nil
+}
+
+func (fs *fileStore) Add(score GameScore) (GameScore, error) {
+	if score.ID == "" {
+		score.ID = newID()
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Insert first so a compaction triggered by the append includes it
+	fs.insert(score)
+	if err := fs.append(journalEntry{Op: "add", Score: &score}); err != nil {
+		fs.remove(score.ID)
+		return score, err
+	}
+	return score, nil
+}
+
+func (fs *fileStore) Delete(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if !fs.remove(id) {
+		return errScoreNotFound
+	}
+	return fs.append(journalEntry{Op: "delete", ID: id})
+}
+
+func (fs *fileStore) AddReplay(r Replay) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.replays[r.ScoreID] = r
+	if err := fs.append(journalEntry{Op: "replay", Replay: &r}); err != nil {
+		delete(fs.replays, r.ScoreID)
+		return err
+	}
+	return nil
+}
+
+func (fs *fileStore) Rescore(points func(GameScore) int) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	changed := fs.rescore(points)
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, fs.compact()
+}
+
+func (fs *fileStore) AddMatch(match MatchResult) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.insertMatch(match)
+	return fs.append(journalEntry{Op: "match", Match: &match})
+}
+
+func (fs *fileStore) AddAccount(a Account) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.insertAccount(a); err != nil {
+		return err
+	}
+	if err := fs.append(journalEntry{Op: "account", Account: &a}); err != nil {
+		delete(fs.accounts, accountKey(a.PlayerName))
+		return err
+	}
+	return nil
+}
+
+func (fs *fileStore) AddUnlocks(unlocks []Unlock) ([]Unlock, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var added []Unlock
+	for _, u := range unlocks {
+		if !fs.insertUnlock(u) {
+			continue
+		}
+		if err := fs.append(journalEntry{Op: "unlock", Unlock: &u}); err != nil {
+			player := playerKey(u.PlayerName, u.PlayerID)
+			fs.unlocks[player] = slices.DeleteFunc(fs.unlocks[player], func(h Unlock) bool {
+				return h.AchievementID == u.AchievementID
+			})
+			return added, err
+		}
+		added = append(added, u)
+	}
+	return added, nil
+}
+
+func (fs *fileStore) Ping(ctx context.Context) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, err := fs.file.Stat()
+	return err
+}
+
+func (fs *fileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.file.Sync(); err != nil {
+		fs.file.Close()
+		return err
+	}
+	return fs.file.Close()
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errNoSQLDriver is reported when the SQLite driver was not compiled in
+var errNoSQLDriver = errors.New("sqlite store requires building with -tags sqlite")
+
+// sqlMigrations are applied in order and tracked through PRAGMA user_version
+var sqlMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS scores (
+		id          TEXT PRIMARY KEY,
+		player_name TEXT NOT NULL,
+		moves       INTEGER NOT NULL,
+		time_taken  REAL NOT NULL,
+		timestamp   INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS scores_rank ON scores (moves, time_taken, timestamp)`,
+	`ALTER TABLE scores ADD COLUMN difficulty TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE scores ADD COLUMN pairs INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS scores_difficulty_rank ON scores (difficulty, moves, time_taken, timestamp)`,
+	`CREATE TABLE IF NOT EXISTS matches (
+		id          TEXT PRIMARY KEY,
+		finished_at INTEGER NOT NULL,
+		data        TEXT NOT NULL
+	)`,
+	`ALTER TABLE scores ADD COLUMN player_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS accounts (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL,
+		name_key      TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		created_at    INTEGER NOT NULL
+	)`,
+	`ALTER TABLE scores ADD COLUMN daily TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS scores_daily_rank ON scores (daily, moves, time_taken, timestamp)`,
+	`ALTER TABLE scores ADD COLUMN score INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE scores ADD COLUMN combo INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS scores_points_rank ON scores (difficulty, daily, score DESC, moves, time_taken, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS scores_player ON scores (player_name, timestamp)`,
+	`CREATE TABLE IF NOT EXISTS unlocks (
+		player_name TEXT NOT NULL,
+		achievement TEXT NOT NULL,
+		score_id    TEXT NOT NULL,
+		unlocked_at INTEGER NOT NULL,
+		PRIMARY KEY (player_name, achievement)
+	)`,
+	`CREATE TABLE IF NOT EXISTS replays (
+		score_id TEXT PRIMARY KEY,
+		data     TEXT NOT NULL
+	)`,
+	`ALTER TABLE scores ADD COLUMN deck TEXT NOT NULL DEFAULT '` + defaultDeck + `'`,
+	`CREATE INDEX IF NOT EXISTS scores_deck_rank ON scores (difficulty, deck, daily, score DESC, moves, time_taken, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS scores_player_id ON scores (player_id, timestamp)`,
+	// Unlocks move to a table keyed by account as well as name, and go to
+	// whoever submitted the game that earned them
+	`ALTER TABLE unlocks RENAME TO unlocks_by_name`,
+	`CREATE TABLE unlocks (
+		player_id   TEXT NOT NULL,
+		player_name TEXT NOT NULL,
+		achievement TEXT NOT NULL,
+		score_id    TEXT NOT NULL,
+		unlocked_at INTEGER NOT NULL,
+		PRIMARY KEY (player_id, player_name, achievement)
+	)`,
+	`INSERT INTO unlocks (player_id, player_name, achievement, score_id, unlocked_at)
+		SELECT COALESCE(s.player_id, ''), u.player_name, u.achievement, u.score_id, u.unlocked_at
+		FROM unlocks_by_name u LEFT JOIN scores s ON s.id = u.score_id`,
+	`DROP TABLE unlocks_by_name`,
+	`ALTER TABLE scores ADD COLUMN flag TEXT NOT NULL DEFAULT ''`,
+	// Folded by accountKey, since SQLite only folds ASCII; see backfillNameKeys
+	`ALTER TABLE scores ADD COLUMN name_key TEXT NOT NULL DEFAULT ''`,
+}
+
+// scoreColumns lists the columns scanned by scanScore, in order
+const scoreColumns = `id, player_name, player_id, difficulty, daily, deck, pairs, moves, time_taken, combo, score, timestamp, flag`
+
+// sqlStore keeps scores in an embedded SQL database
+type sqlStore struct {
+	db *sql.DB
+}
+
+func openSQLStore(driver, dsn string) (*sqlStore, error) {
+	if !slices.Contains(sql.Drivers(), driver) {
+		return nil, errNoSQLDriver
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps SQLite writers from tripping over each other
+	db.SetMaxOpenConns(1)
+
+	s := &sqlStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate brings the schema up to date
+func (s *sqlStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqlMigrations); i++ {
+		if _, err := s.db.Exec(sqlMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := s.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			return err
+		}
+	}
+	return s.backfillNameKeys()
+}
+
+// backfillNameKeys folds the names of scores stored before name_key was
+// added, which SQL can't do for names outside ASCII
+func (s *sqlStore) backfillNameKeys() error {
+	rows, err := s.db.Query(`SELECT id, player_name FROM scores WHERE name_key = ''`)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		names[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(names) == 0 {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, name := range names {
+		if _, err := tx.Exec(`UPDATE scores SET name_key = ? WHERE id = ?`, accountKey(name), id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Add(score GameScore) (GameScore, error) {
+	if score.ID == "" {
+		score.ID = newID()
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO scores (`+scoreColumns+`, name_key) VALUES (`+placeholders(14)+`)`,
+		score.ID, score.PlayerName, score.PlayerID, score.Difficulty, score.Daily, score.Deck, score.Pairs,
+		score.Moves, score.TimeTaken, score.Combo, score.Score, score.Timestamp.UnixNano(), score.Flag,
+		accountKey(score.PlayerName),
+	)
+	return score, err
+}
+
+func (s *sqlStore) Top(difficulty string, n int) ([]GameScore, error) {
+	return s.Query(ScoreQuery{Difficulty: difficulty, Limit: n})
+}
+
+// sqlSorts gives each sort order's ORDER BY clause, and the ascending
+// columns and values keyset cursors compare against as a row value
+var sqlSorts = map[string]struct {
+	order string
+	keys  string
+	key   func(GameScore) []any
+}{
+	sortScore: {"score DESC, moves, time_taken, timestamp, id", "-score, moves, time_taken, timestamp, id", func(s GameScore) []any {
+		return []any{-s.Score, s.Moves, s.TimeTaken, s.Timestamp.UnixNano(), s.ID}
+	}},
+	sortMoves: {"moves, time_taken, timestamp, id", "moves, time_taken, timestamp, id", func(s GameScore) []any {
+		return []any{s.Moves, s.TimeTaken, s.Timestamp.UnixNano(), s.ID}
+	}},
+	sortTime: {"time_taken, moves, timestamp, id", "time_taken, moves, timestamp, id", func(s GameScore) []any {
+		return []any{s.TimeTaken, s.Moves, s.Timestamp.UnixNano(), s.ID}
+	}},
+}
+
+// placeholders returns n comma-separated bind parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// likeEscaper escapes LIKE wildcards so a prefix matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// scoreFilter builds the WHERE conditions for q's filters
+func scoreFilter(q ScoreQuery) (where []string, args []any) {
+	where = []string{"daily = ?"}
+	args = []any{q.Daily}
+	if q.Difficulty != "" {
+		where = append(where, "difficulty = ?", "deck = ?")
+		args = append(args, q.Difficulty, cmp.Or(q.Deck, defaultDeck))
+	}
+	if q.PlayerName != "" || q.PlayerID != "" {
+		w, a := playerFilter(q.PlayerName, q.PlayerID)
+		where, args = append(where, w), append(args, a...)
+	}
+	if q.Flagged {
+		where = append(where, "flag != ''")
+	}
+	if q.PlayerPrefix != "" {
+		// Both sides are folded as the memory store folds them
+		where = append(where, `name_key LIKE ? ESCAPE '\'`)
+		args = append(args, likeEscaper.Replace(accountKey(q.PlayerPrefix))+"%")
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	return where, args
+}
+
+func (s *sqlStore) Query(q ScoreQuery) ([]GameScore, error) {
+	sort, ok := sqlSorts[q.Sort]
+	if !ok {
+		sort = sqlSorts[sortScore]
+	}
+	where, args := scoreFilter(q)
+	if q.After != nil {
+		key := sort.key(*q.After)
+		where = append(where, "("+sort.keys+") > ("+placeholders(len(key))+")")
+		args = append(args, key...)
+	}
+
+	query := `SELECT ` + scoreColumns + ` FROM scores WHERE ` + strings.Join(where, " AND ")
+	query += " ORDER BY " + sort.order
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []GameScore{}
+	for rows.Next() {
+		score, err := scanScore(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, score)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) Count(q ScoreQuery) (int, error) {
+	where, args := scoreFilter(q)
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM scores WHERE `+strings.Join(where, " AND "), args...).Scan(&n)
+	return n, err
+}
+
+func (s *sqlStore) Rank(score GameScore) (int, int, error) {
+	// A daily challenge has one board for the day, as in boardKey
+	board := `daily = ?`
+	args := []any{-score.Score, score.Moves, score.TimeTaken, score.Timestamp.UnixNano(), score.ID, score.Daily}
+	if score.Daily == "" {
+		board = `daily = '' AND difficulty = ? AND deck = ?`
+		args = append(args[:5], score.Difficulty, cmp.Or(score.Deck, defaultDeck))
+	}
+	var better, total int
+	err := s.db.QueryRow(
+		`SELECT
+			COUNT(CASE WHEN (-score, moves, time_taken, timestamp, id) < (?, ?, ?, ?, ?) THEN 1 END),
+			COUNT(*)
+		FROM scores WHERE `+board, args...,
+	).Scan(&better, &total)
+	return better + 1, total, err
+}
+
+// scanScore reads a row selected with scoreColumns
+func scanScore(rows *sql.Rows) (GameScore, error) {
+	var score GameScore
+	var ts int64
+	err := rows.Scan(&score.ID, &score.PlayerName, &score.PlayerID, &score.Difficulty, &score.Daily, &score.Deck, &score.Pairs,
+		&score.Moves, &score.TimeTaken, &score.Combo, &score.Score, &ts, &score.Flag)
+	score.Timestamp = time.Unix(0, ts)
+	score.Guest = score.PlayerID == ""
+	return score, err
+}
+
+func (s *sqlStore) Score(id string) (GameScore, error) {
+	rows, err := s.db.Query(`SELECT `+scoreColumns+` FROM scores WHERE id = ?`, id)
+	if err != nil {
+		return GameScore{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return GameScore{}, err
+		}
+		return GameScore{}, errScoreNotFound
+	}
+	return scanScore(rows)
+}
+
+func (s *sqlStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM scores WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errScoreNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM replays WHERE score_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) AddReplay(r Replay) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO replays (score_id, data) VALUES (?, ?)`, r.ScoreID, string(data))
+	return err
+}
+
+func (s *sqlStore) Replay(scoreID string) (Replay, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM replays WHERE score_id = ?`, scoreID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Replay{}, errReplayNotFound
+	}
+	if err != nil {
+		return Replay{}, err
+	}
+	var r Replay
+	err = json.Unmarshal([]byte(data), &r)
+	return r, err
+}
+
+func (s *sqlStore) DailyWinners(limit int) ([]GameScore, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(
+		`SELECT `+scoreColumns+` FROM scores AS s
+		WHERE daily != '' AND id = (
+			SELECT id FROM scores WHERE daily = s.daily
+			ORDER BY score DESC, moves, time_taken, timestamp, id LIMIT 1
+		)
+		ORDER BY daily DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []GameScore{}
+	for rows.Next() {
+		score, err := scanScore(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, score)
+	}
+	return result, rows.Err()
+}
+
+// playerFilter builds the WHERE condition picking one player's rows, as
+// playerKey tells them apart
+func playerFilter(name, id string) (where string, args []any) {
+	if id != "" {
+		return "player_id = ?", []any{id}
+	}
+	return "player_id = '' AND player_name = ?", []any{name}
+}
+
+func (s *sqlStore) PlayerScores(name, id string) ([]GameScore, error) {
+	where, args := playerFilter(name, id)
+	rows, err := s.db.Query(`SELECT `+scoreColumns+` FROM scores WHERE `+where+` ORDER BY timestamp DESC, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []GameScore{}
+	for rows.Next() {
+		score, err := scanScore(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, score)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) Rescore(points func(GameScore) int) (int, error) {
+	rows, err := s.db.Query(`SELECT ` + scoreColumns + ` FROM scores`)
+	if err != nil {
+		return 0, err
+	}
+	var changed []GameScore
+	for rows.Next() {
+		score, err := scanScore(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if p := points(score); p != score.Score {
+			score.Score = p
+			changed = append(changed, score)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(changed) == 0 {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, score := range changed {
+		if _, err := tx.Exec(`UPDATE scores SET score = ? WHERE id = ?`, score.Score, score.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), tx.Commit()
+}
+
+func (s *sqlStore) AddMatch(match MatchResult) error {
+	data, err := json.Marshal(match)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO matches (id, finished_at, data) VALUES (?, ?, ?)`,
+		match.ID, match.FinishedAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *sqlStore) Matches(limit int) ([]MatchResult, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(`SELECT data FROM matches ORDER BY finished_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []MatchResult{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var match MatchResult
+		if err := json.Unmarshal([]byte(data), &match); err != nil {
+			return nil, err
+		}
+		result = append(result, match)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) AddAccount(a Account) error {
+	if _, err := s.Account(a.PlayerName); err == nil {
+		return errAccountExists
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO accounts (id, name, name_key, password_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		a.ID, a.PlayerName, accountKey(a.PlayerName), a.PasswordHash, a.CreatedAt.UnixNano(),
+	)
+	return err
+}
+
+func (s *sqlStore) Account(name string) (Account, error) {
+	var a Account
+	var created int64
+	err := s.db.QueryRow(
+		`SELECT id, name, password_hash, created_at FROM accounts WHERE name_key = ?`, accountKey(name),
+	).Scan(&a.ID, &a.PlayerName, &a.PasswordHash, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, errAccountNotFound
+	}
+	a.CreatedAt = time.Unix(0, created)
+	return a, err
+}
+
+func (s *sqlStore) AddUnlocks(unlocks []Unlock) ([]Unlock, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var added []Unlock
+	for _, u := range unlocks {
+		res, err := tx.Exec(
+			`INSERT OR IGNORE INTO unlocks (player_id, player_name, achievement, score_id, unlocked_at) VALUES (?, ?, ?, ?, ?)`,
+			u.PlayerID, u.PlayerName, u.AchievementID, u.ScoreID, u.UnlockedAt.UnixNano(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			added = append(added, u)
+		}
+	}
+	return added, tx.Commit()
+}
+
+func (s *sqlStore) Unlocks(name, id string) ([]Unlock, error) {
+	where, args := playerFilter(name, id)
+	rows, err := s.db.Query(
+		`SELECT achievement, score_id, unlocked_at FROM unlocks WHERE `+where+` ORDER BY unlocked_at, rowid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Unlock{}
+	for rows.Next() {
+		u := Unlock{PlayerName: name, PlayerID: id}
+		var unlocked int64
+		if err := rows.Scan(&u.AchievementID, &u.ScoreID, &unlocked); err != nil {
+			return nil, err
+		}
+		u.UnlockedAt = time.Unix(0, unlocked)
+		result = append(result, u)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeKinds are the stores every store test runs against. sqlite is
+// skipped unless built with -tags sqlite.
+var storeKinds = []string{"memory", "file", "sqlite"}
+
+// openTestStore opens a store of kind at path, skipping the test if it
+// isn't built in
+func openTestStore(t *testing.T, kind, path string) ScoreStore {
+	t.Helper()
+	s, err := openStore(kind, path, 0)
+	if errors.Is(err, errNoSQLDriver) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("openStore(%q) error = %v", kind, err)
+	}
+	return s
+}
+
+// forEachStore runs a subtest against a fresh store of each kind
+func forEachStore(t *testing.T, test func(t *testing.T, s ScoreStore, reopen func() ScoreStore)) {
+	for _, kind := range storeKinds {
+		t.Run(kind, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scores")
+			s := openTestStore(t, kind, path)
+			reopen := func() ScoreStore {
+				if kind == "memory" {
+					t.Skip("memory store keeps nothing")
+				}
+				if err := s.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+				s = openTestStore(t, kind, path)
+				return s
+			}
+			t.Cleanup(func() { s.Close() })
+			test(t, s, reopen)
+		})
+	}
+}
+
+// storeFixture is a spread of scores across boards, players and times
+func storeFixture() []GameScore {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var scores []GameScore
+	names := []string{"ana", "Ben", "bea", "cy", "Ana"}
+	for i := range 40 {
+		s := GameScore{
+			ID:         fmt.Sprintf("s%02d", i),
+			PlayerName: names[i%len(names)],
+			Difficulty: []string{"easy", "medium"}[i%2],
+			Deck:       defaultDeck,
+			Pairs:      6,
+			Moves:      6 + i%7,
+			Combo:      1 + i%3,
+			TimeTaken:  float64(10 + i%5),
+			Timestamp:  base.Add(time.Duration(i) * time.Hour),
+		}
+		switch {
+		case i%9 == 0:
+			s.PlayerID = "acc-" + s.PlayerName
+		case i%11 == 0:
+			s.Deck = "animals"
+		case i%13 == 0:
+			s.Daily = "2026-03-02"
+		}
+		if i%8 == 0 {
+			s.Flag = flagEvenPace
+		}
+		s.Guest = s.PlayerID == ""
+		s.Score = scorer.Score(s)
+		scores = append(scores, s)
+	}
+	return scores
+}
+
+// scoreIDs lists the IDs of scores, in order
+func scoreIDs(scores []GameScore) []string {
+	ids := make([]string, len(scores))
+	for i, s := range scores {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// sameScore reports whether a stored score came back unchanged
+func sameScore(a, b GameScore) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return false
+	}
+	a.Timestamp, b.Timestamp = time.Time{}, time.Time{}
+	return a == b
+}
+
+func TestStoresAgree(t *testing.T) {
+	// Names outside ASCII fold the same way in every store
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	fixture := append(storeFixture(),
+		GameScore{ID: "u1", PlayerName: "Émile", Difficulty: "easy", Deck: defaultDeck, Pairs: 6, Moves: 9, Score: 300, Guest: true, Timestamp: at},
+		GameScore{ID: "u2", PlayerName: "élan", Difficulty: "easy", Deck: defaultDeck, Pairs: 6, Moves: 8, Score: 310, Guest: true, Timestamp: at},
+	)
+	cursor := fixture[4]
+	since := fixture[10].Timestamp
+	queries := []ScoreQuery{
+		{Difficulty: "easy"},
+		{Difficulty: "medium", Limit: 5},
+		{Difficulty: "medium", Offset: 3, Limit: 4},
+		{Difficulty: "easy", Deck: "animals"},
+		{Daily: "2026-03-02"},
+		{Difficulty: "easy", Sort: sortMoves},
+		{Difficulty: "medium", Sort: sortTime, Offset: 2},
+		{Difficulty: "easy", After: &cursor, Limit: 3},
+		{Difficulty: "easy", Sort: sortMoves, After: &cursor},
+		{Difficulty: "easy", PlayerPrefix: "a"},
+		{Difficulty: "medium", PlayerPrefix: "B", Limit: 2},
+		{Difficulty: "easy", PlayerPrefix: "%"},
+		{Difficulty: "easy", PlayerPrefix: "é"},
+		{Difficulty: "easy", PlayerPrefix: "ÉL"},
+		{PlayerName: "ana"},
+		{PlayerName: "ana", PlayerID: "acc-ana"},
+		{Difficulty: "easy", Since: since, Until: since.Add(12 * time.Hour)},
+		{Difficulty: "medium", Flagged: true},
+		{Difficulty: "hard"},
+	}
+	probes := []GameScore{fixture[0], fixture[7], fixture[26], {Difficulty: "easy", Deck: defaultDeck, Score: 5000, Moves: 6, TimeTaken: 1}, {Difficulty: "hard", Deck: defaultDeck}}
+
+	want := make(map[int][]string)
+	wantCount := make(map[int]int)
+	wantRank := make(map[int][2]int)
+	forEachStore(t, func(t *testing.T, s ScoreStore, _ func() ScoreStore) {
+		for _, score := range fixture {
+			if _, err := s.Add(score); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The memory store runs first and is the reference for the others
+		reference := len(want) == 0
+		for i, q := range queries {
+			got, err := s.Query(q)
+			if err != nil {
+				t.Fatalf("Query(%+v) error = %v", q, err)
+			}
+			q.Offset, q.Limit, q.After = 0, 0, nil
+			n, err := s.Count(q)
+			if err != nil {
+				t.Fatalf("Count(%+v) error = %v", q, err)
+			}
+			if reference {
+				want[i], wantCount[i] = scoreIDs(got), n
+				continue
+			}
+			if !slices.Equal(scoreIDs(got), want[i]) {
+				t.Errorf("query %d = %v, want %v", i, scoreIDs(got), want[i])
+			}
+			if n != wantCount[i] {
+				t.Errorf("query %d count = %d, want %d", i, n, wantCount[i])
+			}
+		}
+		for i, p := range probes {
+			rank, total, err := s.Rank(p)
+			if err != nil {
+				t.Fatalf("Rank() error = %v", err)
+			}
+			if reference {
+				wantRank[i] = [2]int{rank, total}
+			} else if got := [2]int{rank, total}; got != wantRank[i] {
+				t.Errorf("probe %d rank, total = %v, want %v", i, got, wantRank[i])
+			}
+		}
+	})
+}
+
+// queryFixture answers q by filtering and sorting every score, as a
+// reference for the memory store's indexed paths
+func queryFixture(scores []GameScore, q ScoreQuery) []string {
+	compare := q.compare()
+	var matched []GameScore
+	for _, s := range scores {
+		if q.match(s) && (q.After == nil || compare(s, *q.After) > 0) {
+			matched = append(matched, s)
+		}
+	}
+	slices.SortFunc(matched, compare)
+	matched = matched[min(q.Offset, len(matched)):]
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return scoreIDs(matched)
+}
+
+func TestMemoryStoreQuery(t *testing.T) {
+	// Recent enough that windows are served from the history index
+	now := time.Now().Truncate(time.Second)
+	fixture := storeFixture()
+	for i := range fixture {
+		fixture[i].Timestamp = now.Add(-time.Duration(i) * time.Hour)
+	}
+	s := newMemoryStore(7 * 24 * time.Hour)
+	for _, score := range fixture {
+		if _, err := s.Add(score); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The cursor's score is deleted to check paging resumes from where it stood
+	deleted := fixture[6]
+	if err := s.Delete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	remaining := slices.DeleteFunc(slices.Clone(fixture), func(s GameScore) bool { return s.ID == deleted.ID })
+	cursor := fixture[8]
+
+	queries := map[string]ScoreQuery{
+		"offset":                 {Difficulty: "easy", Offset: 3, Limit: 4},
+		"offset past the end":    {Difficulty: "easy", Offset: 100},
+		"offset filtered":        {Difficulty: "easy", PlayerPrefix: "a", Offset: 2, Limit: 2},
+		"cursor":                 {Difficulty: "easy", After: &cursor, Limit: 3},
+		"cursor and offset":      {Difficulty: "easy", After: &cursor, Offset: 1, Limit: 3},
+		"cursor filtered":        {Difficulty: "easy", PlayerPrefix: "b", After: &cursor},
+		"deleted cursor":         {Difficulty: "easy", After: &deleted, Limit: 5},
+		"cursor sorted by moves": {Difficulty: "easy", Sort: sortMoves, After: &cursor, Limit: 4},
+		"cursor sorted by time":  {Difficulty: "easy", Sort: sortTime, After: &deleted, Offset: 1},
+		"cursor across boards":   {PlayerName: "ana", After: &cursor},
+		"recent window":          {Difficulty: "easy", Since: now.Add(-12 * time.Hour), Limit: 3},
+		"recent window cursor":   {Difficulty: "easy", Since: now.Add(-24 * time.Hour), After: &cursor},
+		"recent window offset":   {Difficulty: "easy", Since: now.Add(-24 * time.Hour), Offset: 2},
+	}
+	for name, q := range queries {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := queryFixture(remaining, q); !slices.Equal(scoreIDs(got), want) {
+				t.Errorf("Query() = %v, want %v", scoreIDs(got), want)
+			}
+		})
+	}
+
+	t.Run("pages by cursor", func(t *testing.T) {
+		q := ScoreQuery{Difficulty: "medium", Limit: 3}
+		var all []string
+		for {
+			page, err := s.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			all = append(all, scoreIDs(page)...)
+			q.After = &page[len(page)-1]
+		}
+		if want := queryFixture(remaining, ScoreQuery{Difficulty: "medium"}); !slices.Equal(all, want) {
+			t.Errorf("pages = %v, want %v", all, want)
+		}
+	})
+}
+
+func TestStoreReopen(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s ScoreStore, reopen func() ScoreStore) {
+		fixture := storeFixture()
+		for _, score := range fixture {
+			if _, err := s.Add(score); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Delete(fixture[3].ID); err != nil {
+			t.Fatal(err)
+		}
+		replay := Replay{ScoreID: fixture[0].ID, Deck: []string{"a", "a"}, Flips: []Flip{{Index: 0, At: fixture[0].Timestamp}}}
+		match := MatchResult{ID: "m1", Difficulty: "easy", Winners: []string{"ana"}, FinishedAt: fixture[0].Timestamp}
+		account := Account{ID: "acc-ana", PlayerName: "ana", PasswordHash: "h", CreatedAt: fixture[0].Timestamp}
+		unlock := Unlock{PlayerName: "ana", PlayerID: "acc-ana", AchievementID: "first-game", ScoreID: fixture[0].ID, UnlockedAt: fixture[0].Timestamp}
+		for _, err := range []error{s.AddReplay(replay), s.AddMatch(match), s.AddAccount(account)} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.AddUnlocks([]Unlock{unlock}); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := s.Query(ScoreQuery{Difficulty: "easy"})
+
+		s = reopen()
+		after, err := s.Query(ScoreQuery{Difficulty: "easy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(before) {
+			t.Fatalf("reopened store has %d easy scores, want %d", len(after), len(before))
+		}
+		for i := range before {
+			if !sameScore(after[i], before[i]) {
+				t.Errorf("score %d = %+v, want %+v", i, after[i], before[i])
+			}
+		}
+		if _, err := s.Score(fixture[3].ID); !errors.Is(err, errScoreNotFound) {
+			t.Errorf("deleted score came back: %v", err)
+		}
+		if got, err := s.Replay(replay.ScoreID); err != nil || len(got.Flips) != 1 || !got.Flips[0].At.Equal(replay.Flips[0].At) {
+			t.Errorf("Replay() = %+v, %v", got, err)
+		}
+		if got, err := s.Matches(0); err != nil || len(got) != 1 || got[0].ID != "m1" {
+			t.Errorf("Matches() = %+v, %v", got, err)
+		}
+		if got, err := s.Account("ANA"); err != nil || got.ID != account.ID {
+			t.Errorf("Account() = %+v, %v", got, err)
+		}
+		if got, err := s.Unlocks("ana", "acc-ana"); err != nil || len(got) != 1 || got[0].AchievementID != "first-game" {
+			t.Errorf("Unlocks() = %+v, %v", got, err)
+		}
+		if got, _ := s.Unlocks("ana", ""); len(got) != 0 {
+			t.Errorf("guest ana holds the account's unlocks: %+v", got)
+		}
+	})
+}
+
+// journalLines counts the entries in a file store's journal
+func journalLines(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(b), "\n")
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.jsonl")
+	fs, err := openFileStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { fs.Close() }()
+
+	fixture := storeFixture()
+	for _, s := range fixture {
+		fs.Add(s)
+	}
+	// Rewriting each score leaves a dead entry behind until compaction
+	for round := range 3 {
+		for _, s := range fixture {
+			s.Moves += round
+			fs.Delete(s.ID)
+			fs.Add(s)
+		}
+	}
+	if n := journalLines(t, path); n > max(compactMinEntries, 2*len(fixture))+1 {
+		t.Errorf("journal holds %d entries for %d scores; it was never compacted", n, len(fixture))
+	}
+
+	fs.Close()
+	fs, err = openFileStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := journalLines(t, path); n != len(fixture) {
+		t.Errorf("journal holds %d entries after reopening, want %d", n, len(fixture))
+	}
+	if got, _ := fs.Score(fixture[0].ID); got.Moves != fixture[0].Moves+2 {
+		t.Errorf("moves = %d, want the last rewrite's %d", got.Moves, fixture[0].Moves+2)
+	}
+}
+
+func TestFileStoreLoadsOldEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.jsonl")
+	journal := `{"op":"add","score":{"id":"old","playerName":"ana","difficulty":"easy","pairs":6,"moves":8,"timeTaken":20,"timestamp":"2025-01-01T00:00:00Z"}}
+{"op":"add","score":{"id":"acc","playerName":"ben","playerId":"acc-ben","difficulty":"easy","pairs":6,"moves":9,"timeTaken":20,"timestamp":"2025-01-02T00:00:00Z"}}
+{"op":"unlock","unlock":{"playerName":"ben","achievement":"first-game","scoreId":"acc","unlockedAt":"2025-01-02T00:00:00Z"}}
+{"op":"add","score":{"id":"gone","playerName":"cy","difficulty":"easy","pairs":6,"moves":9,"timeTaken":20,"timestamp":"2025-01-03T00:00:00Z"}}
+{"op":"delete","id":"gone"}
+`
+	if err := os.WriteFile(path, []byte(journal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := openFileStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	old, err := fs.Score("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Deck != defaultDeck || !old.Guest {
+		t.Errorf("old score deck %q, guest %v; want %q and a guest", old.Deck, old.Guest, defaultDeck)
+	}
+	if acc, _ := fs.Score("acc"); acc.Guest {
+		t.Error("account score loaded as a guest's")
+	}
+	if got, _ := fs.Unlocks("ben", "acc-ben"); len(got) != 1 {
+		t.Errorf("unlock didn't move to the account that earned it: %+v", got)
+	}
+	if _, err := fs.Score("gone"); !errors.Is(err, errScoreNotFound) {
+		t.Errorf("deleted score loaded: %v", err)
+	}
+}
+
+func TestFileStoreCorruptJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.jsonl")
+	journal := `{"op":"add","score":{"id":"a","playerName":"ana","difficulty":"easy"}}
+{"op":"add","score":{"id":"b",`
+	if err := os.WriteFile(path, []byte(journal+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openFileStore(path, 0); err == nil || !strings.Contains(err.Error(), "corrupt journal entry") {
+		t.Errorf("openFileStore() error = %v, want a corrupt entry", err)
+	}
+	// The journal is left alone for someone to repair
+	if b, _ := os.ReadFile(path); string(b) != journal+"\n" {
+		t.Error("corrupt journal was rewritten")
+	}
+}
+
+func TestFileStoreRollsBackFailedAppend(t *testing.T) {
+	fs, err := openFileStore(filepath.Join(t.TempDir(), "scores.jsonl"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes to a closed journal fail
+	fs.file.Close()
+
+	score := storeFixture()[0]
+	if _, err := fs.Add(score); err == nil {
+		t.Error("Add() succeeded")
+	}
+	if _, err := fs.Score(score.ID); !errors.Is(err, errScoreNotFound) {
+		t.Errorf("failed Add left the score behind: %v", err)
+	}
+	if n, _ := fs.Count(ScoreQuery{Difficulty: score.Difficulty}); n != 0 {
+		t.Errorf("failed Add left %d scores ranked", n)
+	}
+	if err := fs.AddReplay(Replay{ScoreID: score.ID}); err == nil {
+		t.Error("AddReplay() succeeded")
+	}
+	if _, err := fs.Replay(score.ID); !errors.Is(err, errReplayNotFound) {
+		t.Errorf("failed AddReplay left the replay behind: %v", err)
+	}
+	if err := fs.AddAccount(Account{ID: "a1", PlayerName: "ana"}); err == nil {
+		t.Error("AddAccount() succeeded")
+	}
+	if _, err := fs.Account("ana"); !errors.Is(err, errAccountNotFound) {
+		t.Errorf("failed AddAccount left the account behind: %v", err)
+	}
+	unlock := Unlock{PlayerName: "ana", AchievementID: "first-game"}
+	if _, err := fs.AddUnlocks([]Unlock{unlock}); err == nil {
+		t.Error("AddUnlocks() succeeded")
+	}
+	if got, _ := fs.Unlocks("ana", ""); len(got) != 0 {
+		t.Errorf("failed AddUnlocks left %+v behind", got)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// streamHistory is how many past events are kept for Last-Event-ID replay
+	streamHistory = 100
+	// streamBuffer is how many events a client may fall behind before eviction
+	streamBuffer = 16
+	// streamHeartbeat is the interval between keep-alive comments
+	streamHeartbeat = 15 * time.Second
+)
+
+// LeaderboardUpdate is pushed to stream clients when a top N changes
+type LeaderboardUpdate struct {
+	Difficulty string      `json:"difficulty"`
+	Scores     []GameScore `json:"scores"`
+}
+
+// streamEvent is a numbered, pre-encoded update
+type streamEvent struct {
+	id         uint64
+	difficulty string
+	data       []byte
+}
+
+// streamClient is one connected subscriber
+type streamClient struct {
+	difficulty string
+	events     chan streamEvent
+}
+
+func (c *streamClient) wants(e streamEvent) bool {
+	return c.difficulty == "" || c.difficulty == e.difficulty
+}
+
+// streamHub fans leaderboard updates out to every connected client
+type streamHub struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []streamEvent
+	clients map[*streamClient]struct{}
+	closed  bool
+}
+
+var leaderboardHub = newStreamHub()
+
+func newStreamHub() *streamHub {
+	return &streamHub{nextID: 1, clients: make(map[*streamClient]struct{})}
+}
+
+// catchUp is what a newly subscribed client needs to get current
+type catchUp struct {
+	// missed are the events since the client's Last-Event-ID
+	missed []streamEvent
+	// snapshot is set when those cannot be replayed and the client needs
+	// the current boards instead, tagged with lastID
+	snapshot bool
+	lastID   uint64
+}
+
+// subscribe registers a client and works out how it catches up from lastID.
+// It reports false once the hub is closed.
+func (h *streamHub) subscribe(c *streamClient, lastID uint64) (catchUp, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return catchUp{}, false
+	}
+	h.clients[c] = struct{}{}
+
+	// IDs restart with the server, and the history only goes back so far
+	if lastID == 0 || lastID >= h.nextID || (len(h.history) > 0 && h.history[0].id > lastID+1) {
+		return catchUp{snapshot: true, lastID: h.nextID - 1}, true
+	}
+	var cu catchUp
+	for _, e := range h.history {
+		if e.id > lastID && c.wants(e) {
+			cu.missed = append(cu.missed, e)
+		}
+	}
+	return cu, true
+}
+
+// unsubscribe removes a client, closing its channel if still open
+func (h *streamHub) unsubscribe(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// publish records an update and delivers it, evicting clients whose
+// buffers are full rather than blocking on them
+func (h *streamHub) publish(update LeaderboardUpdate) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		slog.Error("Failed to encode leaderboard update", "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := streamEvent{id: h.nextID, difficulty: update.Difficulty, data: data}
+	h.nextID++
+	h.history = append(h.history, e)
+	if len(h.history) > streamHistory {
+		h.history = h.history[len(h.history)-streamHistory:]
+	}
+
+	for c := range h.clients {
+		if !c.wants(e) {
+			continue
+		}
+		select {
+		case c.events <- e:
+		default:
+			delete(h.clients, c)
+			close(c.events)
+		}
+	}
+}
+
+// close disconnects every client and refuses new ones
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// publishLeaderboard pushes the current top N of a difficulty
+func publishLeaderboard(difficulty string) {
+	top, err := store.Top(difficulty, leaderboardSize)
+	if err != nil {
+		slog.Error("Failed to load leaderboard", "difficulty", difficulty, "err", err)
+		return
+	}
+	leaderboardHub.publish(LeaderboardUpdate{Difficulty: difficulty, Scores: top})
+}
+
+// writeStreamEvent sends an event in text/event-stream framing, leaving the
+// ID off when there is none yet
+func writeStreamEvent(w http.ResponseWriter, e streamEvent) error {
+	if e.id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: leaderboard\ndata: %s\n\n", e.data)
+	return err
+}
+
+func handleLeaderboardStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	difficulty := r.URL.Query().Get("difficulty")
+	if _, ok := difficultyByName(difficulty); difficulty != "" && !ok {
+		http.Error(w, "Unknown difficulty", http.StatusBadRequest)
+		return
+	}
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	c := &streamClient{difficulty: difficulty, events: make(chan streamEvent, streamBuffer)}
+	cu, ok := leaderboardHub.subscribe(c, lastID)
+	if !ok {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer leaderboardHub.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	for _, e := range cu.missed {
+		if writeStreamEvent(w, e) != nil {
+			return
+		}
+	}
+	if cu.snapshot {
+		for _, d := range difficulties {
+			if difficulty != "" && d.Name != difficulty {
+				continue
+			}
+			top, err := store.Top(d.Name, leaderboardSize)
+			if err != nil {
+				return
+			}
+			data, _ := json.Marshal(LeaderboardUpdate{Difficulty: d.Name, Scores: top})
+			e := streamEvent{id: cu.lastID, difficulty: d.Name, data: data}
+			if writeStreamEvent(w, e) != nil {
+				return
+			}
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-c.events:
+			if !ok {
+				// Evicted for falling behind, or the server is shutting down
+				return
+			}
+			if writeStreamEvent(w, e) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxBodyBytes caps the size of JSON request bodies
+	maxBodyBytes = 4 << 10
+	// maxNameLength is the longest player name accepted, in characters
+	maxNameLength = 15
+	// minFlipSeconds is the fastest a human can plausibly flip a card
+	minFlipSeconds = 0.2
+)
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field error of a rejected request
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns e if any field failed, or nil
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// writeValidationError responds 422 with the list of field errors
+func writeValidationError(w http.ResponseWriter, err error) {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{"Validation failed", verr.Fields})
+}
+
+// decodeBody reads a size-limited JSON body into v, writing an error
+// response and returning false if it cannot
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	case err != nil:
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validNameRune reports whether r may appear in a player name. Markup
+// characters are excluded so names are always safe to render.
+func validNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-' || r == '_' || r == '.'
+}
+
+// normalizePlayerName trims and defaults a name, recording any problems in verr
+func normalizePlayerName(name string, verr *ValidationError) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "Player"
+	}
+	if !utf8.ValidString(name) {
+		verr.add("playerName", "must be valid UTF-8")
+		return name
+	}
+	if n := utf8.RuneCountInString(name); n > maxNameLength {
+		verr.add("playerName", "must be at most %d characters, got %d", maxNameLength, n)
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return !validNameRune(r) }) >= 0 {
+		verr.add("playerName", "may only contain letters, digits, spaces and - _ .")
+	}
+	return name
+}
+
+// validateScore checks that a score is plausible for its difficulty preset
+func validateScore(score GameScore) error {
+	verr := &ValidationError{}
+	normalizePlayerName(score.PlayerName, verr)
+
+	difficulty, ok := difficultyByName(score.Difficulty)
+	if !ok {
+		verr.add("difficulty", "unknown difficulty %q", score.Difficulty)
+		return verr
+	}
+	if score.Pairs != difficulty.Pairs {
+		verr.add("pairs", "must be %d for %s", difficulty.Pairs, difficulty.Name)
+	}
+	if score.Moves < difficulty.Pairs {
+		verr.add("moves", "must be at least %d", difficulty.Pairs)
+	}
+	if score.Combo < 0 || score.Combo > difficulty.Pairs {
+		verr.add("combo", "must be between 0 and %d", difficulty.Pairs)
+	}
+	// Every flip after the first takes at least minFlipSeconds
+	if minTime := float64(2*difficulty.Pairs-1) * minFlipSeconds; score.TimeTaken < minTime {
+		verr.add("timeTaken", "must be at least %.1f seconds", minTime)
+	}
+	return verr.err()
+}
@@ -0,0 +1,62 @@
+package main
+
+import "math"
+
+const (
+	// minFlipGapSeconds is the shortest pause a person can leave between
+	// two clicks; any faster flip flags the game. Gaps are measured as
+	// flips reach the server, where network jitter can bunch two clicks
+	// closer together than they were made, so this sits well below
+	// minFlipSeconds, the fastest average validateScore allows.
+	minFlipGapSeconds = 0.08
+	// regularFlips is how many flips it takes before evenly paced play is
+	// suspicious
+	regularFlips = 10
+	// minFlipJitterSeconds is the least variation expected between a
+	// person's flips; steadier pacing flags the game
+	minFlipJitterSeconds = 0.01
+)
+
+// Reasons a score is flagged
+const (
+	flagFastFlip = "fast_flip"
+	flagEvenPace = "even_pace"
+)
+
+// verifyPace flags a game whose flips followed the rules but don't look
+// human. The rules themselves need no checking here: the session applied
+// them to every flip as it arrived, and the score is computed from it.
+func verifyPace(replay Replay) string {
+	gaps := make([]float64, 0, len(replay.Flips))
+	for i := 1; i < len(replay.Flips); i++ {
+		gaps = append(gaps, replay.Flips[i].At.Sub(replay.Flips[i-1].At).Seconds())
+	}
+	return flipPaceFlag(gaps)
+}
+
+// flipPaceFlag names what, if anything, is inhuman about the gaps between
+// flips: one too quick to click, or a long run paced like a metronome
+func flipPaceFlag(gaps []float64) string {
+	if len(gaps) == 0 {
+		return ""
+	}
+	var sum float64
+	for _, g := range gaps {
+		if g < minFlipGapSeconds {
+			return flagFastFlip
+		}
+		sum += g
+	}
+	if len(gaps) < regularFlips {
+		return ""
+	}
+	mean := sum / float64(len(gaps))
+	var variance float64
+	for _, g := range gaps {
+		variance += (g - mean) * (g - mean)
+	}
+	if math.Sqrt(variance/float64(len(gaps))) < minFlipJitterSeconds {
+		return flagEvenPace
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFlipPaceFlag(t *testing.T) {
+	even := make([]float64, regularFlips)
+	uneven := make([]float64, regularFlips)
+	for i := range even {
+		even[i] = 0.5
+		uneven[i] = 0.4 + 0.05*float64(i%3)
+	}
+	tests := []struct {
+		name string
+		gaps []float64
+		want string
+	}{
+		{"no gaps", nil, ""},
+		{"human", uneven, ""},
+		{"one fast flip", append([]float64{0.05}, uneven...), flagFastFlip},
+		// Arrivals bunched by the network still look human
+		{"one quick flip", append([]float64{0.1}, uneven...), ""},
+		{"metronome", even, flagEvenPace},
+		{"too short to judge pace", even[:regularFlips-1], ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flipPaceFlag(tt.gaps); got != tt.want {
+				t.Errorf("flipPaceFlag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleScoreFlagsPace(t *testing.T) {
+	useStore(t, newMemoryStore(0))
+	tests := []struct {
+		name string
+		gaps []time.Duration
+		want string
+	}{
+		{"human", []time.Duration{700 * time.Millisecond, 1100 * time.Millisecond, 900 * time.Millisecond}, ""},
+		{"one inhumanly fast flip", []time.Duration{time.Second, 50 * time.Millisecond, time.Second, 1200 * time.Millisecond}, flagFastFlip},
+		{"steady script", []time.Duration{time.Second}, flagEvenPace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGame(t, "")
+			at := time.Now()
+			for i := range g.Pairs {
+				for _, index := range []int{i, i + g.Pairs} {
+					if _, err := g.flip(index, at); err != nil {
+						t.Fatal(err)
+					}
+					at = at.Add(tt.gaps[len(g.Flips)%len(tt.gaps)])
+				}
+			}
+			if got := postScore(g.ID, ""); got != http.StatusOK {
+				t.Fatalf("status = %d, want flagged scores accepted", got)
+			}
+			s, err := store.Score(g.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Flag != tt.want {
+				t.Errorf("Flag = %q, want %q", s.Flag, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//go:embed web
+var embeddedWeb embed.FS
+
+// asset is a file prepared for serving with its validators and, for
+// compressible types, brotli and gzipped copies
+type asset struct {
+	name        string
+	contentType string
+	data        []byte
+	brotli      []byte
+	gzipped     []byte
+	etag        string
+	modTime     time.Time
+}
+
+var (
+	// webFiles holds the templates/ and static/ trees
+	webFiles fs.FS
+	// devMode re-reads files from disk on every request
+	devMode bool
+	// assets caches prepared static files when not in devMode
+	assets = make(map[string]*asset)
+	// page is the rendered home page when not in devMode
+	page *asset
+	// startTime stands in for the modification time of embedded files
+	startTime = time.Now()
+)
+
+// setupWeb selects where pages and assets come from and, outside dev mode,
+// prepares them all up front
+func setupWeb(dev bool) error {
+	devMode = dev
+	if dev {
+		webFiles = os.DirFS("web")
+		_, err := fs.Stat(webFiles, "templates/index.html")
+		return err
+	}
+
+	sub, err := fs.Sub(embeddedWeb, "web")
+	if err != nil {
+		return err
+	}
+	webFiles = sub
+
+	err = fs.WalkDir(webFiles, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		a, err := readAsset(strings.TrimPrefix(p, "static/"))
+		if err != nil {
+			return err
+		}
+		assets[a.name] = a
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	page, err = renderPage()
+	return err
+}
+
+// newAsset computes the validators and compressed form of a file
+func newAsset(name string, data []byte, modTime time.Time) *asset {
+	sum := sha256.Sum256(data)
+	a := &asset{
+		name:        name,
+		contentType: mime.TypeByExtension(path.Ext(name)),
+		data:        data,
+		etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modTime:     modTime,
+	}
+	if a.contentType == "" {
+		a.contentType = http.DetectContentType(data)
+	}
+
+	if compressible(a.contentType) && len(data) > 512 {
+		var buf bytes.Buffer
+		bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		bw.Write(data)
+		bw.Close()
+		if buf.Len() < len(data) {
+			a.brotli = bytes.Clone(buf.Bytes())
+		}
+
+		buf.Reset()
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(data)
+		zw.Close()
+		if buf.Len() < len(data) {
+			a.gzipped = buf.Bytes()
+		}
+	}
+	return a
+}
+
+// compressible reports whether content of this type benefits from compression
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "svg")
+}
+
+// readAsset loads a file from the static tree
+func readAsset(name string) (*asset, error) {
+	p := path.Join("static", name)
+	data, err := fs.ReadFile(webFiles, p)
+	if err != nil {
+		return nil, err
+	}
+	modTime := startTime
+	if info, err := fs.Stat(webFiles, p); err == nil && !info.ModTime().IsZero() {
+		modTime = info.ModTime()
+	}
+	return newAsset(name, data, modTime), nil
+}
+
+// lookupAsset returns a prepared static file, reading it from disk in dev mode
+func lookupAsset(name string) (*asset, error) {
+	if devMode {
+		return readAsset(name)
+	}
+	a, ok := assets[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return a, nil
+}
+
+// renderPage executes the home page template
+func renderPage() (*asset, error) {
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		// asset links a static file with its ETag so browsers can cache it forever
+		"asset": func(name string) (string, error) {
+			a, err := lookupAsset(name)
+			if err != nil {
+				return "", err
+			}
+			return "/static/" + name + "?v=" + strings.Trim(a.etag, `"`), nil
+		},
+	}).ParseFS(webFiles, "templates/index.html")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Daily Difficulty
+	}{dailyPreset()})
+	if err != nil {
+		return nil, err
+	}
+	return newAsset("index.html", buf.Bytes(), startTime), nil
+}
+
+// acceptsEncoding reports whether the client accepts responses in the
+// given content coding
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) == encoding {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// serveAsset writes a file honouring conditional and range requests,
+// compressed with brotli or gzip when the client accepts them
+func serveAsset(w http.ResponseWriter, r *http.Request, a *asset, cacheControl string) {
+	if devMode {
+		cacheControl = "no-cache"
+	}
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	body, etag := a.data, a.etag
+	// Brotli is preferred for being smaller
+	switch {
+	case a.brotli != nil && acceptsEncoding(r, "br"):
+		body = a.brotli
+		etag = strings.TrimSuffix(a.etag, `"`) + `-br"`
+		w.Header().Set("Content-Encoding", "br")
+	case a.gzipped != nil && acceptsEncoding(r, "gzip"):
+		body = a.gzipped
+		etag = strings.TrimSuffix(a.etag, `"`) + `-gzip"`
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, a.name, a.modTime, bytes.NewReader(body))
+}
+
+func handleHome(w http.ResponseWriter, r *http.Request) {
+	p := page
+	if devMode {
+		var err error
+		if p, err = renderPage(); err != nil {
+			serverError(w, r, "Failed to render page: "+err.Error(), err)
+			return
+		}
+	}
+	serveAsset(w, r, p, "no-cache")
+}
+
+func handleStatic(w http.ResponseWriter, r *http.Request) {
+	a, err := lookupAsset(strings.TrimPrefix(r.URL.Path, "/static/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	serveAsset(w, r, a, "public, max-age=31536000, immutable")
+}
@@ -0,0 +1,868 @@
+let gameId = null;
+let gameDeckType = 'emoji';
+let flippedCards = [];
+let flipPending = false;
+let matchedPairs = 0;
+let moves = 0;
+let timer = null;
+let seconds = 0;
+let difficulty = null;
+let difficultyList = [];
+let daily = false;
+let deck = 'neon';
+let deckType = 'emoji';
+let deckList = [];
+let leaderboardWindow = 'all';
+const timeZone = Intl.DateTimeFormat().resolvedOptions().timeZone || 'UTC';
+let playerName = 'Player';
+let gameStarted = false;
+let account = null;
+
+// Difficulty selection; the presets come from the server, ahead of the
+// daily challenge button
+async function loadDifficulties() {
+    try {
+        difficultyList = await fetch('/api/difficulties').then(res => res.json());
+    } catch (e) {
+        console.error('Failed to load difficulties:', e);
+        return;
+    }
+    const dailyBtn = document.querySelector('.daily-btn');
+    difficultyList.forEach((d, i) => {
+        const btn = document.createElement('button');
+        btn.className = 'difficulty-btn' + (i === 0 ? ' active' : '');
+        btn.dataset.difficulty = d.name;
+        btn.textContent = `${d.name.toUpperCase()} (${d.pairs})`;
+        btn.addEventListener('click', () => selectDifficulty(btn));
+        dailyBtn.before(btn);
+    });
+    difficulty = difficultyList[0].name;
+}
+
+function selectDifficulty(btn) {
+    document.querySelectorAll('.difficulty-btn').forEach(b => b.classList.remove('active'));
+    btn.classList.add('active');
+    difficulty = btn.dataset.difficulty;
+    daily = btn.dataset.daily === 'true';
+    loadLeaderboard();
+}
+
+document.querySelector('.daily-btn').addEventListener('click', e => selectDifficulty(e.currentTarget));
+
+// layoutBoard sets a board's grid to its difficulty's columns, widening it
+// for large boards
+function layoutBoard(board, name) {
+    const d = difficultyList.find(d => d.name === name);
+    const cols = d ? d.columns : 4;
+    board.style.gridTemplateColumns = `repeat(${cols}, 1fr)`;
+    board.style.maxWidth = `${Math.max(500, cols * 100)}px`;
+    board.classList.toggle('large', cols > 4);
+}
+
+// Decks are listed by the server; the daily challenge always uses the default
+async function loadDecks() {
+    try {
+        deckList = await fetch('/api/decks').then(res => res.json());
+    } catch (e) {
+        console.error('Failed to load decks:', e);
+        return;
+    }
+    const select = document.getElementById('deckSelect');
+    select.innerHTML = '';
+    deckList.forEach(d => {
+        const btn = document.createElement('button');
+        btn.className = 'window-btn' + (d.id === deck ? ' active' : '');
+        btn.title = `${d.size} faces`;
+        d.preview.slice(0, 3).forEach(face => {
+            const span = document.createElement('span');
+            span.className = 'deck-preview';
+            setFace(span, face, d.type);
+            btn.appendChild(span);
+        });
+        btn.append(' ' + d.name.toUpperCase());
+        btn.addEventListener('click', () => {
+            select.querySelectorAll('.window-btn').forEach(b => b.classList.remove('active'));
+            btn.classList.add('active');
+            deck = d.id;
+            deckType = d.type;
+            loadLeaderboard();
+        });
+        select.appendChild(btn);
+    });
+}
+
+// setFace draws a card face: image decks send a URL, the rest the symbol
+function setFace(el, face, type) {
+    el.textContent = '';
+    el.classList.toggle('text-face', type === 'text');
+    if (type === 'image') {
+        const img = document.createElement('img');
+        img.src = face;
+        img.alt = '';
+        el.appendChild(img);
+    } else {
+        el.textContent = face;
+    }
+}
+
+// deckTypeOf finds how a listed deck's faces are drawn
+function deckTypeOf(id) {
+    const d = deckList.find(d => d.id === id);
+    return d ? d.type : 'emoji';
+}
+
+// Leaderboard window selection; calendar windows follow the local time zone
+document.querySelectorAll('.window-btn').forEach(btn => {
+    btn.addEventListener('click', () => {
+        document.querySelectorAll('.window-btn').forEach(b => b.classList.remove('active'));
+        btn.classList.add('active');
+        leaderboardWindow = btn.dataset.window;
+        loadLeaderboard();
+    });
+});
+
+async function createBoard() {
+    const board = document.getElementById('gameBoard');
+    board.innerHTML = '';
+
+    layoutBoard(board, difficulty);
+
+    // The deck is shuffled on the server; faces are only revealed on flip
+    try {
+        const res = await fetch('/api/game', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ playerName: playerName, difficulty: difficulty, daily: daily, deck: deck })
+        });
+        if (!res.ok) {
+            alert(await errorMessage(res, 'Failed to start game'));
+            goToMenu();
+            return;
+        }
+        const game = await res.json();
+        gameId = game.id;
+        gameDeckType = game.deckType;
+
+        for (let index = 0; index < game.cards; index++) {
+            const card = document.createElement('div');
+            card.className = 'card';
+            card.innerHTML = `
+                <div class="card-inner">
+                    <div class="card-back"></div>
+                    <div class="card-front"></div>
+                </div>
+            `;
+            card.addEventListener('click', () => flipCard(card, index));
+            board.appendChild(card);
+        }
+    } catch (e) {
+        console.error('Failed to create game:', e);
+    }
+}
+
+async function flipCard(card, index) {
+    if (flipPending || flippedCards.length >= 2 || card.classList.contains('flipped') || card.classList.contains('matched')) {
+        return;
+    }
+
+    flipPending = true;
+    let result;
+    try {
+        const res = await fetch(`/api/game/${gameId}/flip`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ index: index })
+        });
+        if (!res.ok) {
+            return;
+        }
+        result = await res.json();
+    } catch (e) {
+        console.error('Failed to flip card:', e);
+        return;
+    } finally {
+        flipPending = false;
+    }
+
+    if (!gameStarted) {
+        startTimer();
+        gameStarted = true;
+    }
+
+    setFace(card.querySelector('.card-front'), result.face, gameDeckType);
+    card.classList.add('flipped');
+    flippedCards.push(card);
+
+    if (flippedCards.length === 2) {
+        moves = result.moves;
+        document.getElementById('movesCount').textContent = moves;
+
+        if (result.matched) {
+            // Match!
+            setTimeout(() => {
+                flippedCards.forEach(fc => fc.classList.add('matched'));
+                matchedPairs = result.matchedPairs;
+                document.getElementById('matchesCount').textContent = matchedPairs;
+                flippedCards = [];
+
+                if (result.finished) {
+                    endGame();
+                }
+            }, 300);
+        } else {
+            // No match
+            setTimeout(() => {
+                flippedCards.forEach(fc => fc.classList.remove('flipped'));
+                flippedCards = [];
+            }, 1000);
+        }
+    }
+}
+
+function startTimer() {
+    timer = setInterval(() => {
+        seconds++;
+        const mins = Math.floor(seconds / 60);
+        const secs = seconds % 60;
+        document.getElementById('timerDisplay').textContent = `${mins}:${secs.toString().padStart(2, '0')}`;
+    }, 1000);
+}
+
+function stopTimer() {
+    clearInterval(timer);
+    timer = null;
+}
+
+function formatTime(totalSeconds) {
+    const mins = Math.floor(totalSeconds / 60);
+    const secs = Math.floor(totalSeconds % 60);
+    return `${mins}:${secs.toString().padStart(2, '0')}`;
+}
+
+function endGame() {
+    stopTimer();
+
+    document.getElementById('finalScore').textContent = '–';
+    document.getElementById('achievementToasts').innerHTML = '';
+    document.getElementById('finalMoves').textContent = moves;
+    document.getElementById('finalTime').textContent = formatTime(seconds);
+    document.getElementById('winModal').classList.add('active');
+
+    // Submit score
+    submitScore();
+}
+
+async function submitScore() {
+    try {
+        // Moves and time are computed by the server from the recorded flips
+        const res = await fetch('/api/score', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ gameId: gameId })
+        });
+        if (res.ok) {
+            const result = await res.json();
+            document.getElementById('finalScore').textContent = result.score.toLocaleString();
+            document.getElementById('finalMoves').textContent = result.moves;
+            document.getElementById('finalTime').textContent = formatTime(result.timeTaken);
+
+            let rankText = `You placed #${result.rank.toLocaleString()} of ${result.total.toLocaleString()}`;
+            if (result.personalBest && result.previousBest) {
+                rankText += ' · New personal best!';
+            }
+            document.getElementById('finalRank').textContent = rankText;
+            showUnlocks(result.achievements || []);
+        }
+        loadLeaderboard();
+    } catch (e) {
+        console.error('Failed to submit score:', e);
+    }
+}
+
+// showUnlocks pops a toast in the win modal for each newly unlocked badge
+function showUnlocks(unlocked) {
+    document.getElementById('achievementToasts').innerHTML = unlocked.map((a, i) => `
+        <div class="achievement-toast" style="animation-delay: ${i * 0.4}s">
+            <span class="badge-icon">${a.icon}</span>
+            <span>
+                <strong>Unlocked: ${escapeHTML(a.name)}</strong><br>
+                <small>${escapeHTML(a.description)}</small>
+            </span>
+        </div>
+    `).join('');
+}
+
+// errorMessage describes a failed response from its field errors or text
+async function errorMessage(res, fallback) {
+    const text = await res.text().catch(() => '');
+    try {
+        const err = JSON.parse(text);
+        if (err.fields) {
+            return err.fields.map(f => `${f.field} ${f.message}`).join('\n');
+        }
+    } catch (e) {
+        // Plain text error
+    }
+    return text.trim() || fallback;
+}
+
+function renderAccount() {
+    const nameInput = document.getElementById('playerName');
+    document.getElementById('accountForm').style.display = account ? 'none' : '';
+    document.getElementById('accountStatus').style.display = account ? 'block' : '';
+    nameInput.disabled = !!account;
+    if (account) {
+        nameInput.value = account.playerName;
+        document.getElementById('accountName').textContent = account.playerName;
+    }
+}
+
+async function loadAccount() {
+    try {
+        const res = await fetch('/api/session');
+        account = res.ok ? await res.json() : null;
+        renderAccount();
+    } catch (e) {
+        console.error('Failed to load account:', e);
+    }
+}
+
+// Registering and signing in both answer with the account and set the
+// session cookie
+async function authenticate(path) {
+    const passwordInput = document.getElementById('password');
+    try {
+        const res = await fetch(path, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                playerName: document.getElementById('playerName').value,
+                password: passwordInput.value
+            })
+        });
+        if (!res.ok) {
+            alert(await errorMessage(res, 'Failed to sign in'));
+            return;
+        }
+        account = await res.json();
+        passwordInput.value = '';
+        renderAccount();
+    } catch (e) {
+        console.error('Failed to sign in:', e);
+    }
+}
+
+function signIn() {
+    authenticate('/api/session');
+}
+
+function register() {
+    authenticate('/api/accounts');
+}
+
+async function signOut() {
+    await fetch('/api/session', { method: 'DELETE' }).catch(() => null);
+    account = null;
+    renderAccount();
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// Scores verification flagged stay ranked but are marked as under review
+const flagReasons = {
+    fast_flip: 'Flips faster than a person can click',
+    even_pace: 'Flips paced too evenly for a person'
+};
+
+function flagTag(score) {
+    if (!score.flag) return '';
+    const reason = flagReasons[score.flag] || score.flag;
+    return `<span class="flag-tag" title="${escapeHTML(reason)}">under review</span>`;
+}
+
+function renderLeaderboard(scores, title) {
+    const list = document.getElementById('leaderboardList');
+    document.getElementById('leaderboardDifficulty').textContent = title || difficulty.toUpperCase();
+
+    if (scores && scores.length > 0) {
+        list.innerHTML = scores.slice(0, 5).map((score, i) => `
+            <li class="leaderboard-item">
+                <span class="rank">#${i + 1}</span>
+                <span class="player-name">${playerLink(score.playerName)}${score.guest ? '<span class="guest-tag">guest</span>' : ''}${flagTag(score)}</span>
+                <span class="player-score" title="${score.moves} moves in ${formatTime(score.timeTaken)}">${score.score.toLocaleString()} pts</span>
+                ${replayLink(score.id)}
+            </li>
+        `).join('');
+    } else {
+        list.innerHTML = '<li class="leaderboard-item" style="color: #555;">No scores yet. Be the first!</li>';
+    }
+}
+
+async function loadLeaderboard() {
+    document.getElementById('dailyArchive').style.display = daily ? 'block' : 'none';
+    document.getElementById('windowSelect').style.display = daily ? 'none' : 'flex';
+    document.getElementById('deckSelect').style.display = daily ? 'none' : 'flex';
+    try {
+        if (daily) {
+            await loadDaily();
+            return;
+        }
+        const params = new URLSearchParams({ difficulty: difficulty, deck: deck, window: leaderboardWindow, tz: timeZone });
+        const res = await fetch(`/api/leaderboard?${params}`);
+        const title = difficulty.toUpperCase() + (deck !== 'neon' ? ` · ${deck.toUpperCase()}` : '');
+        renderLeaderboard((await res.json()).scores, title);
+    } catch (e) {
+        console.error('Failed to load leaderboard:', e);
+    }
+}
+
+// The daily board resets at midnight UTC; past days keep their winner
+async function loadDaily() {
+    const [today, archive] = await Promise.all([
+        fetch('/api/daily').then(res => res.json()),
+        fetch('/api/daily/archive?limit=7').then(res => res.json())
+    ]);
+    renderLeaderboard(today.scores, `DAILY ${today.date}`);
+
+    const list = document.getElementById('dailyArchiveList');
+    if (archive.length > 0) {
+        list.innerHTML = archive.map(score => `
+            <li class="leaderboard-item">
+                <span class="rank">${score.daily}</span>
+                <span class="player-name">${playerLink(score.playerName)}</span>
+                <span class="player-score">${score.score.toLocaleString()} pts</span>
+            </li>
+        `).join('');
+    } else {
+        list.innerHTML = '<li class="leaderboard-item" style="color: #555;">No past challenges yet</li>';
+    }
+}
+
+// Push new high scores as they happen; EventSource reconnects on its own
+// and resumes from the last event it saw
+function watchLeaderboard() {
+    if (!window.EventSource) {
+        return;
+    }
+    const source = new EventSource('/api/leaderboard/stream');
+    source.addEventListener('leaderboard', e => {
+        const update = JSON.parse(e.data);
+        if (daily || deck !== 'neon' || update.difficulty !== difficulty) {
+            return;
+        }
+        // Updates carry the all-time board; a new top score may also
+        // change a windowed one
+        if (leaderboardWindow === 'all') {
+            renderLeaderboard(update.scores);
+        } else {
+            loadLeaderboard();
+        }
+    });
+}
+
+function startGame() {
+    const nameInput = document.getElementById('playerName');
+    playerName = nameInput.value.trim() || 'Player';
+
+    document.getElementById('startScreen').style.display = 'none';
+    document.getElementById('gameContainer').classList.add('active');
+
+    resetGame();
+    createBoard();
+}
+
+function resetGame() {
+    stopTimer();
+    gameId = null;
+    flippedCards = [];
+    matchedPairs = 0;
+    moves = 0;
+    seconds = 0;
+    gameStarted = false;
+
+    document.getElementById('movesCount').textContent = '0';
+    document.getElementById('timerDisplay').textContent = '0:00';
+    document.getElementById('matchesCount').textContent = '0';
+    document.getElementById('winModal').classList.remove('active');
+    document.getElementById('finalRank').textContent = '';
+}
+
+function restartGame() {
+    resetGame();
+    createBoard();
+}
+
+function goToMenu() {
+    resetGame();
+    document.getElementById('gameContainer').classList.remove('active');
+    document.getElementById('startScreen').style.display = 'block';
+    document.getElementById('winModal').classList.remove('active');
+    loadLeaderboard();
+}
+
+// Head-to-head rooms: the server holds the board and pushes its state to
+// every player over a WebSocket
+let roomSocket = null;
+let roomPlayerId = null;
+let roomState = null;
+
+async function createRoom() {
+    try {
+        const res = await fetch('/api/rooms', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ difficulty: difficulty })
+        });
+        if (!res.ok) {
+            alert('Failed to create room');
+            return;
+        }
+        const room = await res.json();
+        joinRoom(room.code);
+    } catch (e) {
+        console.error('Failed to create room:', e);
+    }
+}
+
+function joinRoom(code) {
+    code = (code || document.getElementById('roomCode').value).trim().toUpperCase();
+    if (!code) {
+        return;
+    }
+    playerName = document.getElementById('playerName').value.trim() || 'Player';
+
+    const scheme = location.protocol === 'https:' ? 'wss' : 'ws';
+    const socket = new WebSocket(`${scheme}://${location.host}/api/rooms/${encodeURIComponent(code)}/ws?playerName=${encodeURIComponent(playerName)}`);
+    roomSocket = socket;
+    roomPlayerId = null;
+    roomState = null;
+
+    socket.addEventListener('message', e => {
+        const msg = JSON.parse(e.data);
+        if (msg.type === 'welcome') {
+            roomPlayerId = msg.playerId;
+        } else if (msg.type === 'state') {
+            renderRoom(msg);
+        } else if (msg.type === 'error') {
+            document.getElementById('roomStatus').textContent = msg.message;
+        }
+    });
+    socket.addEventListener('close', () => {
+        if (roomSocket !== socket) {
+            return;
+        }
+        if (!roomPlayerId) {
+            alert('Could not join room ' + code);
+            leaveRoom();
+        } else if (!roomState || roomState.state !== 'finished') {
+            document.getElementById('roomStatus').textContent = 'Disconnected';
+        }
+    });
+
+    document.getElementById('roomCodeDisplay').textContent = code;
+    document.getElementById('roomPlayers').innerHTML = '';
+    document.getElementById('roomBoard').innerHTML = '';
+    document.getElementById('roomStatus').textContent = 'Connecting...';
+    document.getElementById('roomStartBtn').style.display = 'none';
+    document.getElementById('startScreen').style.display = 'none';
+    document.getElementById('roomContainer').classList.add('active');
+}
+
+function renderRoom(state) {
+    roomState = state;
+    const me = state.players.findIndex(p => p.id === roomPlayerId);
+
+    document.getElementById('roomPlayers').innerHTML = state.players.map((p, i) => `
+        <li class="room-player${state.state === 'playing' && i === state.turn ? ' turn' : ''}${p.connected ? '' : ' gone'}">
+            ${escapeHTML(p.name)}${i === me ? ' (you)' : ''}
+            <span class="player-score">${p.pairs} pairs</span>
+        </li>
+    `).join('');
+
+    let status;
+    if (state.state === 'waiting') {
+        status = `Waiting for players (${state.players.length}/4)`;
+    } else if (state.state === 'playing') {
+        status = state.turn === me ? 'Your turn' : `${state.players[state.turn].name}'s turn`;
+    } else {
+        status = state.winners.length > 1 ? `Draw: ${state.winners.join(' & ')}` : `${state.winners[0]} wins!`;
+    }
+    document.getElementById('roomStatus').textContent = status;
+    document.getElementById('roomStartBtn').style.display =
+        state.state === 'waiting' && me === 0 && state.players.length >= 2 ? '' : 'none';
+
+    const board = document.getElementById('roomBoard');
+    if (board.children.length !== state.cards.length) {
+        board.innerHTML = '';
+        layoutBoard(board, state.difficulty);
+        state.cards.forEach((_, index) => {
+            const card = document.createElement('div');
+            card.className = 'card';
+            card.innerHTML = `
+                <div class="card-inner">
+                    <div class="card-back"></div>
+                    <div class="card-front"></div>
+                </div>
+            `;
+            card.addEventListener('click', () => flipRoomCard(index));
+            board.appendChild(card);
+        });
+    }
+    state.cards.forEach((face, index) => {
+        const card = board.children[index];
+        if (face) {
+            card.querySelector('.card-front').textContent = face;
+        }
+        card.classList.toggle('flipped', face !== '');
+        card.classList.toggle('matched', face !== '' && !state.faceUp.includes(index));
+    });
+}
+
+function flipRoomCard(index) {
+    const state = roomState;
+    if (!state || state.state !== 'playing' || state.players[state.turn].id !== roomPlayerId || state.cards[index]) {
+        return;
+    }
+    roomSocket.send(JSON.stringify({ type: 'flip', index: index }));
+}
+
+function startRoom() {
+    roomSocket.send(JSON.stringify({ type: 'start' }));
+}
+
+function leaveRoom() {
+    const socket = roomSocket;
+    roomSocket = null;
+    if (socket) {
+        socket.close();
+    }
+    document.getElementById('roomContainer').classList.remove('active');
+    goToMenu();
+}
+
+// playerLink renders a name that opens the player's profile
+function playerLink(name) {
+    return `<a href="#" class="player-link" data-player="${escapeHTML(name)}">${escapeHTML(name)}</a>`;
+}
+
+// replayLink renders a button that plays a score's game back
+function replayLink(id) {
+    return `<a href="#" class="replay-link" data-replay="${escapeHTML(id)}" title="Watch replay">▶</a>`;
+}
+
+document.addEventListener('click', e => {
+    const link = e.target.closest('.player-link');
+    if (link) {
+        e.preventDefault();
+        showProfile(link.dataset.player);
+    }
+    const replayBtn = e.target.closest('.replay-link');
+    if (replayBtn) {
+        e.preventDefault();
+        showReplay(replayBtn.dataset.replay);
+    }
+});
+
+async function showProfile(name) {
+    const res = await fetch(`/api/players/${encodeURIComponent(name)}`);
+    if (!res.ok) {
+        alert(await errorMessage(res, 'Failed to load profile'));
+        return;
+    }
+    const p = await res.json();
+
+    document.getElementById('profileName').textContent = p.playerName + (p.registered ? '' : ' (guest)');
+    const stat = (value, label) => `
+        <div class="stat">
+            <div class="stat-value">${value}</div>
+            <div class="stat-label">${label}</div>
+        </div>
+    `;
+    document.getElementById('profileSummary').innerHTML =
+        stat(p.gamesPlayed, 'Games') +
+        stat(`${p.dayStreak.current} / ${p.dayStreak.longest}`, 'Day streak (now / best)') +
+        stat(`${p.matchWins} / ${p.matches}`, 'Match wins') +
+        stat(`${p.winStreak.current} / ${p.winStreak.longest}`, 'Win streak (now / best)');
+
+    const badges = await fetch(`/api/players/${encodeURIComponent(name)}/achievements`)
+        .then(r => r.ok ? r.json() : { achievements: [] });
+    document.getElementById('profileBadges').innerHTML = badges.achievements.map(a => `
+        <span class="badge ${a.unlockedAt ? 'unlocked' : ''}"
+              title="${escapeHTML(a.description)}${a.unlockedAt ? ' · ' + new Date(a.unlockedAt).toLocaleDateString() : ''}">
+            <span class="badge-icon">${a.icon}</span> ${escapeHTML(a.name)}
+        </span>
+    `).join('');
+
+    document.getElementById('profileDifficulties').innerHTML = p.difficulties.map(d => `
+        <tr>
+            <td>${d.difficulty.toUpperCase()}</td>
+            <td>${d.games}</td>
+            <td>${d.bestScore.toLocaleString()} pts</td>
+            <td>${d.bestMoves} / ${d.averageMoves} / ${d.medianMoves}</td>
+            <td>${formatTime(d.bestTime)} / ${formatTime(d.averageTime)} / ${formatTime(d.medianTime)}</td>
+        </tr>
+    `).join('') || '<tr><td colspan="5">No games yet</td></tr>';
+
+    document.getElementById('profileRecent').innerHTML = p.recent.map(s => `
+        <li class="leaderboard-item">
+            <span class="rank">${new Date(s.timestamp).toLocaleDateString()}</span>
+            <span class="player-name">${s.daily ? 'DAILY' : s.difficulty.toUpperCase()} · ${s.moves} moves · ${formatTime(s.timeTaken)}</span>
+            <span class="player-score">${s.score.toLocaleString()} pts</span>
+            ${replayLink(s.id)}
+        </li>
+    `).join('') || '<li class="leaderboard-item" style="color: #555;">No games yet</li>';
+
+    document.getElementById('startScreen').style.display = 'none';
+    document.getElementById('profileContainer').classList.add('active');
+}
+
+function closeProfile() {
+    document.getElementById('profileContainer').classList.remove('active');
+    document.getElementById('startScreen').style.display = 'block';
+}
+
+// Replays play a recorded game back on a read-only board, pausing between
+// flips as long as the player did, scaled by the chosen speed
+let replay = null;
+let replayStep = 0;
+let replayFaceUp = [];
+let replaySpeed = 1;
+let replayTimer = null;
+let replayReturnTo = null;
+
+document.querySelectorAll('#replaySpeed .window-btn').forEach(btn => {
+    btn.addEventListener('click', () => {
+        document.querySelectorAll('#replaySpeed .window-btn').forEach(b => b.classList.remove('active'));
+        btn.classList.add('active');
+        replaySpeed = parseFloat(btn.dataset.speed);
+        if (replayTimer) {
+            clearTimeout(replayTimer);
+            scheduleReplayFlip();
+        }
+    });
+});
+
+async function showReplay(id) {
+    const res = await fetch(`/api/replays/${encodeURIComponent(id)}`);
+    if (!res.ok) {
+        alert(await errorMessage(res, 'Failed to load replay'));
+        return;
+    }
+    replay = await res.json();
+
+    const s = replay.score;
+    const board = s.daily ? 'DAILY ' + s.daily
+        : s.difficulty.toUpperCase() + (s.deck !== 'neon' ? ' · ' + s.deck.toUpperCase() : '');
+    document.getElementById('replayTitle').textContent = `${s.playerName} · ${board} · ${s.score.toLocaleString()} pts`;
+
+    replayReturnTo = document.getElementById('profileContainer').classList.contains('active')
+        ? 'profileContainer' : 'startScreen';
+    document.getElementById('startScreen').style.display = 'none';
+    document.getElementById('profileContainer').classList.remove('active');
+    document.getElementById('replayContainer').classList.add('active');
+    restartReplay();
+}
+
+function restartReplay() {
+    clearTimeout(replayTimer);
+    replayStep = 0;
+    replayFaceUp = [];
+
+    const board = document.getElementById('replayBoard');
+    layoutBoard(board, replay.score.difficulty);
+    board.innerHTML = replay.deck.map(() => `
+        <div class="card">
+            <div class="card-inner">
+                <div class="card-back"></div>
+                <div class="card-front"></div>
+            </div>
+        </div>
+    `).join('');
+
+    document.getElementById('replayMoves').textContent = '0';
+    document.getElementById('replayTime').textContent = '0:00';
+    document.getElementById('replayMatches').textContent = '0';
+    document.getElementById('replayPlayBtn').textContent = 'PAUSE';
+    scheduleReplayFlip();
+}
+
+// scheduleReplayFlip waits out the recorded gap before the next flip
+function scheduleReplayFlip() {
+    if (replayStep >= replay.flips.length) {
+        replayTimer = null;
+        document.getElementById('replayPlayBtn').textContent = 'PLAY';
+        return;
+    }
+    const gap = replayStep === 0 ? 500
+        : new Date(replay.flips[replayStep].at) - new Date(replay.flips[replayStep - 1].at);
+    replayTimer = setTimeout(() => {
+        applyReplayFlip();
+        scheduleReplayFlip();
+    }, gap / replaySpeed);
+}
+
+// applyReplayFlip mirrors the server's rules: a missed pair stays face up
+// until the next flip
+function applyReplayFlip() {
+    const flip = replay.flips[replayStep++];
+    const cards = document.querySelectorAll('#replayBoard .card');
+    if (replayFaceUp.length === 2) {
+        replayFaceUp.forEach(i => cards[i].classList.remove('flipped'));
+        replayFaceUp = [];
+    }
+
+    setFace(cards[flip.index].querySelector('.card-front'), replay.deck[flip.index], deckTypeOf(replay.score.deck));
+    cards[flip.index].classList.add('flipped');
+    replayFaceUp.push(flip.index);
+
+    if (replayFaceUp.length === 2) {
+        const moves = document.getElementById('replayMoves');
+        moves.textContent = parseInt(moves.textContent) + 1;
+        const [a, b] = replayFaceUp;
+        if (replay.deck[a] === replay.deck[b]) {
+            cards[a].classList.add('matched');
+            cards[b].classList.add('matched');
+            replayFaceUp = [];
+            document.getElementById('replayMatches').textContent =
+                document.querySelectorAll('#replayBoard .card.matched').length / 2;
+        }
+    }
+    const elapsed = (new Date(flip.at) - new Date(replay.flips[0].at)) / 1000;
+    document.getElementById('replayTime').textContent = formatTime(elapsed);
+}
+
+function toggleReplay() {
+    const btn = document.getElementById('replayPlayBtn');
+    if (replayTimer) {
+        clearTimeout(replayTimer);
+        replayTimer = null;
+        btn.textContent = 'PLAY';
+    } else if (replayStep >= replay.flips.length) {
+        restartReplay();
+    } else {
+        btn.textContent = 'PAUSE';
+        scheduleReplayFlip();
+    }
+}
+
+function closeReplay() {
+    clearTimeout(replayTimer);
+    replayTimer = null;
+    document.getElementById('replayContainer').classList.remove('active');
+    if (replayReturnTo === 'profileContainer') {
+        document.getElementById('profileContainer').classList.add('active');
+    } else {
+        document.getElementById('startScreen').style.display = 'block';
+    }
+}
+
+// Load the account, presets, decks and leaderboard on page load and keep the
+// leaderboard live
+loadAccount();
+loadDecks();
+loadDifficulties().then(loadLeaderboard);
+watchLeaderboard();
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestServeAssetEncoding(t *testing.T) {
+	data := []byte(strings.Repeat("body { color: #0ff; }\n", 100))
+	a := newAsset("style.css", data, time.Unix(1000, 0))
+	if a.brotli == nil || a.gzipped == nil {
+		t.Fatal("compressible asset has no compressed copies")
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		encoding string
+	}{
+		{"none", "", ""},
+		{"gzip only", "gzip, deflate", "gzip"},
+		{"brotli preferred", "gzip, deflate, br", "br"},
+		{"brotli refused", "br;q=0, gzip", "gzip"},
+		{"identity only", "identity", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/static/style.css", nil)
+			r.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			serveAsset(w, r, a, "no-cache")
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			var body io.Reader = w.Body
+			switch tt.encoding {
+			case "br":
+				body = brotli.NewReader(w.Body)
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("decoded body differs from the file (err %v)", err)
+			}
+			// Each encoding is a different representation, so needs its own ETag
+			if etag := w.Header().Get("ETag"); tt.encoding != "" && !strings.HasSuffix(etag, "-"+tt.encoding+`"`) {
+				t.Errorf("ETag = %s for %s", etag, tt.encoding)
+			}
+		})
+	}
+
+	small := newAsset("tiny.css", []byte("a{}"), time.Unix(1000, 0))
+	if small.brotli != nil || small.gzipped != nil {
+		t.Error("tiny asset was compressed")
+	}
+}
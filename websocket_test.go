@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// clientFrame encodes a frame as a client sends it. A nil mask leaves it
+// unmasked, which servers must reject.
+func clientFrame(fin bool, rsv, op byte, payload []byte, mask []byte) []byte {
+	b0 := rsv<<4 | op
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	var maskBit byte
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame = append(frame, mask...)
+	for i, c := range payload {
+		frame = append(frame, c^mask[i%4])
+	}
+	return frame
+}
+
+var testMask = []byte{0x37, 0xfa, 0x21, 0x3d}
+
+// serverFrame is a frame the server wrote
+type serverFrame struct {
+	op      byte
+	payload []byte
+}
+
+// pipeConn returns a server connection reading the given client bytes,
+// and a channel of every frame the server writes back
+func pipeConn(t *testing.T, input []byte) (*wsConn, <-chan serverFrame) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+
+	go func() {
+		client.Write(input)
+	}()
+	written := make(chan serverFrame, 16)
+	go func() {
+		defer close(written)
+		br := bufio.NewReader(client)
+		for {
+			var head [2]byte
+			if _, err := io.ReadFull(br, head[:]); err != nil {
+				return
+			}
+			n := int(head[1] & 0x7F)
+			if n == 126 {
+				var ext [2]byte
+				io.ReadFull(br, ext[:])
+				n = int(binary.BigEndian.Uint16(ext[:]))
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(br, payload); err != nil {
+				return
+			}
+			written <- serverFrame{head[0] & 0x0F, payload}
+		}
+	}()
+	return &wsConn{conn: server, br: bufio.NewReader(server)}, written
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		name  string
+		input [][]byte
+		want  string
+	}{
+		{"masked text", [][]byte{clientFrame(true, 0, wsOpText, []byte("hello"), testMask)}, "hello"},
+		{"empty", [][]byte{clientFrame(true, 0, wsOpText, nil, testMask)}, ""},
+		{"16-bit length", [][]byte{clientFrame(true, 0, wsOpBinary, big, testMask)}, string(big)},
+		{"fragmented", [][]byte{
+			clientFrame(false, 0, wsOpText, []byte("hel"), testMask),
+			clientFrame(false, 0, wsOpContinuation, []byte("lo "), testMask),
+			clientFrame(true, 0, wsOpContinuation, []byte("world"), testMask),
+		}, "hello world"},
+		{"pong skipped", [][]byte{
+			clientFrame(true, 0, wsOpPong, nil, testMask),
+			clientFrame(true, 0, wsOpText, []byte("after"), testMask),
+		}, "after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := pipeConn(t, bytes.Join(tt.input, nil))
+			got, err := c.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketReadMessageRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input [][]byte
+		want  error
+	}{
+		{"unmasked", [][]byte{clientFrame(true, 0, wsOpText, []byte("hi"), nil)}, errWSProtocol},
+		{"rsv bit", [][]byte{clientFrame(true, 0x4, wsOpText, []byte("hi"), testMask)}, errWSProtocol},
+		{"unknown opcode", [][]byte{clientFrame(true, 0, 0x3, nil, testMask)}, errWSProtocol},
+		{"fragmented ping", [][]byte{clientFrame(false, 0, wsOpPing, nil, testMask)}, errWSProtocol},
+		{"oversize ping", [][]byte{clientFrame(true, 0, wsOpPing, make([]byte, 126), testMask)}, errWSProtocol},
+		{"oversize frame", [][]byte{clientFrame(true, 0, wsOpText, make([]byte, wsMaxMessage+1), testMask)}, errWSTooLarge},
+		{"oversize message", [][]byte{
+			clientFrame(false, 0, wsOpText, make([]byte, wsMaxMessage), testMask),
+			clientFrame(true, 0, wsOpContinuation, []byte("x"), testMask),
+		}, errWSTooLarge},
+		{"continuation first", [][]byte{clientFrame(true, 0, wsOpContinuation, []byte("x"), testMask)}, errWSProtocol},
+		{"text inside fragments", [][]byte{
+			clientFrame(false, 0, wsOpText, []byte("a"), testMask),
+			clientFrame(true, 0, wsOpText, []byte("b"), testMask),
+		}, errWSProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := pipeConn(t, bytes.Join(tt.input, nil))
+			if _, err := c.ReadMessage(); !errors.Is(err, tt.want) {
+				t.Errorf("ReadMessage() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketControlFrames(t *testing.T) {
+	t.Run("ping between fragments", func(t *testing.T) {
+		c, written := pipeConn(t, bytes.Join([][]byte{
+			clientFrame(false, 0, wsOpText, []byte("a"), testMask),
+			clientFrame(true, 0, wsOpPing, []byte("keepalive"), testMask),
+			clientFrame(true, 0, wsOpContinuation, []byte("b"), testMask),
+		}, nil))
+		got, err := c.ReadMessage()
+		if err != nil || string(got) != "ab" {
+			t.Fatalf("ReadMessage() = %q, %v; want \"ab\"", got, err)
+		}
+		if f := <-written; f.op != wsOpPong || string(f.payload) != "keepalive" {
+			t.Errorf("reply = op %#x %q, want pong \"keepalive\"", f.op, f.payload)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		c, written := pipeConn(t, clientFrame(true, 0, wsOpClose, []byte{0x03, 0xE8}, testMask))
+		if _, err := c.ReadMessage(); !errors.Is(err, errWSClosed) {
+			t.Fatalf("ReadMessage() error = %v, want %v", err, errWSClosed)
+		}
+		if f := <-written; f.op != wsOpClose || !bytes.Equal(f.payload, []byte{0x03, 0xE8}) {
+			t.Errorf("reply = op %#x %v, want close 1000", f.op, f.payload)
+		}
+		if err := c.WriteMessage([]byte("late")); !errors.Is(err, errWSClosed) {
+			t.Errorf("WriteMessage() after close error = %v, want %v", err, errWSClosed)
+		}
+	})
+}
+
+func TestWebSocketWriteFrame(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 300, 0xFFFF} {
+		c, written := pipeConn(t, nil)
+		payload := bytes.Repeat([]byte("y"), n)
+		if err := c.WriteMessage(payload); err != nil {
+			t.Fatalf("WriteMessage(%d bytes) error = %v", n, err)
+		}
+		if f := <-written; f.op != wsOpText || !bytes.Equal(f.payload, payload) {
+			t.Errorf("WriteMessage(%d bytes) sent op %#x with %d bytes", n, f.op, len(f.payload))
+		}
+	}
+}
+
+func TestUpgradeWebSocket(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if msg, err := c.ReadMessage(); err == nil {
+			c.WriteMessage(msg)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("handshake and echo", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// The example key and accept value from RFC 6455 section 1.3
+		req := "GET / HTTP/1.1\r\nHost: " + srv.Listener.Addr().String() + "\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+		conn.Write([]byte(req))
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("status = %d, want 101", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Sec-WebSocket-Accept = %q", got)
+		}
+
+		conn.Write(clientFrame(true, 0, wsOpText, []byte("echo"), testMask))
+		var head [2]byte
+		io.ReadFull(br, head[:])
+		payload := make([]byte, head[1]&0x7F)
+		io.ReadFull(br, payload)
+		if head[0] != 0x80|wsOpText || string(payload) != "echo" {
+			t.Errorf("echo = %#x %q", head[0], payload)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"not an upgrade", map[string]string{}, http.StatusUpgradeRequired},
+		{"old version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusBadRequest},
+		{"missing key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest},
+		{"cross origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if len(tt.headers) > 0 {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Sec-WebSocket-Version", "13")
+				req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Embed the time zone database for hosts without one
+	_ "time/tzdata"
+)
+
+// minHistory is the shortest history that covers every calendar window: a
+// 31-day month plus the widest time zone offsets
+const minHistory = 32 * 24 * time.Hour
+
+// maxWindow bounds rolling windows to the history the store keeps
+var maxWindow = minHistory
+
+var errWindowTooLong = errors.New("window exceeds the score history kept")
+
+// windowStart returns when the leaderboard window named by window begins,
+// or the zero time for all time. Calendar windows (day, week, month) start
+// at midnight in loc, with weeks starting on Monday; rolling windows such
+// as 24h or 7d reach back that long from now.
+func windowStart(window string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+	y, m, d := now.Date()
+	switch window {
+	case "", "all":
+		return time.Time{}, nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), nil
+	case "week":
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		return time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, loc), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), nil
+	}
+
+	span, err := parseSpan(window)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-span), nil
+}
+
+// parseSpan reads a rolling window of whole hours or days, such as 24h or
+// 7d, no longer than maxWindow
+func parseSpan(s string) (time.Duration, error) {
+	unit := time.Hour
+	n, ok := strings.CutSuffix(s, "h")
+	if !ok {
+		n, ok = strings.CutSuffix(s, "d")
+		unit = 24 * time.Hour
+	}
+	count, err := strconv.Atoi(n)
+	if !ok || err != nil || count < 1 {
+		return 0, fmt.Errorf("unknown window %q", s)
+	}
+	if count > int(maxWindow/unit) {
+		return 0, errWindowTooLong
+	}
+	return time.Duration(count) * unit, nil
+}